@@ -0,0 +1,177 @@
+package arweave
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/everFinance/goar"
+	"github.com/everFinance/goar/types"
+	"github.com/everFinance/goar/utils"
+	"github.com/permadao/transbot/notionopt"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Document a translated page to be published
+type Document struct {
+	SourceID string
+	// PageID the translated notion page
+	PageID   string
+	Language string
+	Mode     string
+	Title    string
+	// Blocks the content of the translated page
+	Blocks   []notion.Block
+	HTML     string
+	Markdown string
+}
+
+// Page the JSON rendition of a document
+type Page struct {
+	ID       string         `json:"id"`
+	SourceID string         `json:"source_id"`
+	Language string         `json:"language"`
+	Mode     string         `json:"mode"`
+	Title    string         `json:"title"`
+	Blocks   []notion.Block `json:"blocks"`
+}
+
+// Publication the bundle transaction a document was published in,
+// every rendition is a data item of the bundle
+type Publication struct {
+	TxID       string `json:"tx_id"`
+	PageID     string `json:"page_id"`
+	HTMLID     string `json:"html_id"`
+	MarkdownID string `json:"markdown_id"`
+	// Hash of the published content, unchanged documents are not published again
+	Hash string `json:"hash"`
+}
+
+// Publisher publishing documents to arweave as ANS-104 bundles,
+// signed and paid by the wallet
+type Publisher struct {
+	wallet  *goar.Wallet
+	signer  *goar.ItemSigner
+	gateway string
+}
+
+// NewPublisher
+// @Pararm walletPath, arweave JWK wallet file
+// @Pararm gatewayURL, gateway the transactions are posted to, like https://arweave.net
+func NewPublisher(walletPath, gatewayURL string) (*Publisher, error) {
+	wallet, err := goar.NewWalletFromPath(walletPath, gatewayURL)
+	if err != nil {
+		return nil, fmt.Errorf("load arweave wallet error: %w", err)
+	}
+	signer, err := goar.NewItemSigner(wallet.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("create item signer error: %w", err)
+	}
+	return &Publisher{
+		wallet:  wallet,
+		signer:  signer,
+		gateway: strings.TrimSuffix(gatewayURL, "/"),
+	}, nil
+}
+
+// Address the wallet address paying the transactions
+func (p *Publisher) Address() string {
+	return p.wallet.Signer.Address
+}
+
+// URL the gateway url of a transaction or data item
+func (p *Publisher) URL(id string) string {
+	return p.gateway + "/" + id
+}
+
+// Hash the content hash of the document, see Publication.Hash.
+// Only the stable content is hashed: language, mode, title, the blocks of the
+// page item and the renditions without the parts changing on every run,
+// see notionopt.BlocksDigest and notionopt.StableRendering
+func Hash(doc Document) string {
+	h := sha256.New()
+	for _, part := range []string{
+		doc.Language,
+		doc.Mode,
+		doc.Title,
+		notionopt.BlocksDigest(doc.Blocks),
+		notionopt.StableRendering(doc.Markdown),
+		notionopt.StableRendering(doc.HTML),
+	} {
+		// length prefixed, so that parts can't run into each other
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Publish signing the page, its html and markdown renditions as data items
+// and posting them in a single bundle transaction
+func (p *Publisher) Publish(doc Document) (*Publication, error) {
+	log.WithField("page", doc.PageID).Info("arweave: publish page")
+	pageJson, err := json.Marshal(Page{
+		ID:       notionopt.NormalizeID(doc.PageID),
+		SourceID: notionopt.NormalizeID(doc.SourceID),
+		Language: doc.Language,
+		Mode:     doc.Mode,
+		Title:    doc.Title,
+		Blocks:   doc.Blocks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal page error: %w", err)
+	}
+
+	pageItem, err := p.signer.CreateAndSignItem(pageJson, "", "", documentTags(doc, "page", "application/json"))
+	if err != nil {
+		return nil, fmt.Errorf("sign page item error: %w", err)
+	}
+	htmlItem, err := p.signer.CreateAndSignItem([]byte(doc.HTML), "", "", documentTags(doc, "html", "text/html; charset=utf-8"))
+	if err != nil {
+		return nil, fmt.Errorf("sign html item error: %w", err)
+	}
+	markdownItem, err := p.signer.CreateAndSignItem([]byte(doc.Markdown), "", "", documentTags(doc, "markdown", "text/markdown; charset=utf-8"))
+	if err != nil {
+		return nil, fmt.Errorf("sign markdown item error: %w", err)
+	}
+
+	bundle, err := utils.NewBundle(pageItem, htmlItem, markdownItem)
+	if err != nil {
+		return nil, fmt.Errorf("create bundle error: %w", err)
+	}
+	tx, err := p.wallet.SendBundleTx(bundle.BundleBinary, appTags())
+	if err != nil {
+		return nil, fmt.Errorf("send bundle transaction error: %w", err)
+	}
+	log.WithField("page", doc.PageID).Infof("arweave: page published, tx: %s", tx.ID)
+
+	return &Publication{
+		TxID:       tx.ID,
+		PageID:     pageItem.Id,
+		HTMLID:     htmlItem.Id,
+		MarkdownID: markdownItem.Id,
+		Hash:       Hash(doc),
+	}, nil
+}
+
+func appTags() []types.Tag {
+	return []types.Tag{
+		{Name: "App-Name", Value: viper.GetString("appname")},
+		{Name: "App-Version", Value: viper.GetString("version")},
+	}
+}
+
+// documentTags tags of a rendition, to find the translations of a page with graphql
+func documentTags(doc Document, rendition, contentType string) []types.Tag {
+	return append(appTags(), []types.Tag{
+		{Name: "Content-Type", Value: contentType},
+		{Name: "Type", Value: rendition},
+		{Name: "Source-Page", Value: notionopt.NormalizeID(doc.SourceID)},
+		{Name: "Notion-Page", Value: notionopt.NormalizeID(doc.PageID)},
+		{Name: "Language", Value: doc.Language},
+		{Name: "Mode", Value: doc.Mode},
+		{Name: "Title", Value: doc.Title},
+	}...)
+}
@@ -0,0 +1,225 @@
+package arweave
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/everFinance/goar/types"
+	"github.com/everFinance/goar/utils"
+	"github.com/permadao/transbot/notionopt"
+)
+
+func renderedDocument(date time.Time, fileURL string) Document {
+	blocks := []notion.Block{
+		notionopt.SourceCallout("source-id", "gpt-4o", date),
+		notion.BlockDTO{
+			Type: notion.BlockTypeImage,
+			Image: &notion.ImageBlock{
+				Type:     notion.FileTypeExternal,
+				External: &notion.FileExternal{URL: fileURL},
+			},
+		},
+	}
+	return Document{
+		SourceID: "source-id",
+		PageID:   "page-id",
+		Language: "zh",
+		Mode:     "translation",
+		Title:    "标题",
+		Blocks:   blocks,
+		HTML:     notionopt.RenderHTML("标题", "zh", blocks),
+		Markdown: notionopt.RenderMarkdown("标题", blocks),
+	}
+}
+
+func TestHashStable(t *testing.T) {
+	first := renderedDocument(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/image.png?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=aaa")
+	second := renderedDocument(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		"https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/image.png?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=bbb")
+	if Hash(first) != Hash(second) {
+		t.Error("the callout date and the signed file url changed the hash")
+	}
+
+	other := renderedDocument(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/other/image.png?X-Amz-Signature=aaa")
+	if Hash(first) == Hash(other) {
+		t.Error("another file did not change the hash")
+	}
+	retitled := first
+	retitled.Title = "另一个标题"
+	if Hash(first) == Hash(retitled) {
+		t.Error("another title did not change the hash")
+	}
+
+	// a change the renderers drop still changes the published page item
+	recolored := first
+	callout := first.Blocks[0].(notion.BlockDTO)
+	content := *callout.Callout
+	content.Color = notion.ColorBlueBg
+	callout.Callout = &content
+	recolored.Blocks = []notion.Block{callout, first.Blocks[1]}
+	if Hash(first) == Hash(recolored) {
+		t.Error("a block only change did not change the hash")
+	}
+}
+
+// jwkWallet writing a new 4096 bit RSA key as a JWK wallet file,
+// ANS-104 data items are signed with 4096 bit keys only
+func jwkWallet(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Precompute()
+	enc := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+	jwk, err := json.Marshal(map[string]string{
+		"kty": "RSA",
+		"n":   enc(key.N),
+		"e":   enc(big.NewInt(int64(key.E))),
+		"d":   enc(key.D),
+		"p":   enc(key.Primes[0]),
+		"q":   enc(key.Primes[1]),
+		"dp":  enc(key.Precomputed.Dp),
+		"dq":  enc(key.Precomputed.Dq),
+		"qi":  enc(key.Precomputed.Qinv),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	err = os.WriteFile(path, jwk, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// gateway a local arweave gateway stand-in, keeping the posted transactions
+type gateway struct {
+	mu  sync.Mutex
+	txs []types.Transaction
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/price/"):
+		w.Write([]byte("1000"))
+	case r.Method == http.MethodGet && r.URL.Path == "/tx_anchor":
+		w.Write([]byte(base64.RawURLEncoding.EncodeToString(make([]byte, 48))))
+	case r.Method == http.MethodPost && r.URL.Path == "/tx":
+		var tx types.Transaction
+		err := json.NewDecoder(r.Body).Decode(&tx)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		g.mu.Lock()
+		g.txs = append(g.txs, tx)
+		g.mu.Unlock()
+		w.Write([]byte("OK"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	gw := &gateway{}
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	publisher, err := NewPublisher(jwkWallet(t), server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := publisher.URL("abc"); got != server.URL+"/abc" {
+		t.Errorf("URL() = %s", got)
+	}
+
+	doc := renderedDocument(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "https://example.com/image.png")
+	publication, err := publisher.Publish(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publication.Hash != Hash(doc) {
+		t.Errorf("publication hash = %s, want %s", publication.Hash, Hash(doc))
+	}
+
+	if len(gw.txs) != 1 {
+		t.Fatalf("gateway got %d transactions, want 1", len(gw.txs))
+	}
+	tx := gw.txs[0]
+	if tx.ID != publication.TxID {
+		t.Errorf("posted tx %s, publication tx %s", tx.ID, publication.TxID)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(tx.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := utils.DecodeBundle(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Items) != 3 {
+		t.Fatalf("bundle has %d items, want 3", len(bundle.Items))
+	}
+
+	ids := []string{publication.PageID, publication.HTMLID, publication.MarkdownID}
+	renditions := []string{"page", "html", "markdown"}
+	for i, item := range bundle.Items {
+		err = utils.VerifyBundleItem(item)
+		if err != nil {
+			t.Errorf("item %d: %v", i, err)
+		}
+		if item.Id != ids[i] {
+			t.Errorf("item %d id = %s, want %s", i, item.Id, ids[i])
+		}
+		tags := make(map[string]string)
+		for _, tag := range item.Tags {
+			tags[tag.Name] = tag.Value
+		}
+		if tags["Type"] != renditions[i] || tags["Language"] != "zh" || tags["Notion-Page"] != "pageid" {
+			t.Errorf("item %d tags = %v", i, tags)
+		}
+	}
+
+	// the page rendition carries the fields of the translation only
+	pageData, err := base64.RawURLEncoding.DecodeString(bundle.Items[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page map[string]json.RawMessage
+	err = json.Unmarshal(pageData, &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"id", "source_id", "language", "mode", "title", "blocks"} {
+		if _, ok := page[field]; !ok {
+			t.Errorf("page json misses %s", field)
+		}
+	}
+	if len(page) != 6 {
+		t.Errorf("page json has unexpected fields: %s", pageData)
+	}
+	markdown, err := base64.RawURLEncoding.DecodeString(bundle.Items[2].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(markdown) != doc.Markdown {
+		t.Errorf("markdown item = %q, want %q", markdown, doc.Markdown)
+	}
+}
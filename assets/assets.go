@@ -0,0 +1,71 @@
+package assets
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+)
+
+// Asset store backends, as configured in assets.backend
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+	BackendNone  = "none"
+)
+
+// AssetStore re-hosting images and files uploaded to notion,
+// whose urls expire after an hour
+type AssetStore interface {
+	// Name of the backend, as configured in assets.backend
+	Name() string
+	// Stat looking up the object stored under key
+	// @Return url, public url of the object, found is false if it doesn't exist
+	Stat(ctx context.Context, key string) (url string, found bool, err error)
+	// Put storing the object under key
+	// @Pararm body, read to the end, S3 needs a seekable body like a file to sign it
+	// @Return url, public url of the stored object
+	Put(ctx context.Context, key, contentType string, body io.Reader) (url string, err error)
+}
+
+// NewAssetStore creating the backend selected by name,
+// settings are read from the section of the same name in [assets].
+// Without a backend configured the legacy [4everland] section is used if set.
+func NewAssetStore(name string) (AssetStore, error) {
+	if name == "" {
+		if viper.GetString("4everland.key") == "" {
+			return NewNoneStore(), nil
+		}
+		bucket := viper.GetString("4everland.bucket_name")
+		return NewS3Store(S3Config{
+			Endpoint:  viper.GetString("4everland.endpoint"),
+			Key:       viper.GetString("4everland.key"),
+			Secret:    viper.GetString("4everland.secret"),
+			Bucket:    bucket,
+			PublicURL: fmt.Sprintf("https://%s.4everland.store", bucket),
+		})
+	}
+
+	switch name {
+	case BackendS3:
+		return NewS3Store(S3Config{
+			Endpoint:  viper.GetString("assets.s3.endpoint"),
+			Region:    viper.GetString("assets.s3.region"),
+			Key:       viper.GetString("assets.s3.key"),
+			Secret:    viper.GetString("assets.s3.secret"),
+			Bucket:    viper.GetString("assets.s3.bucket"),
+			PublicURL: viper.GetString("assets.s3.public_url"),
+			PathStyle: viper.GetBool("assets.s3.path_style"),
+		})
+	case BackendLocal:
+		return NewLocalStore(
+			viper.GetString("assets.local.dir"),
+			viper.GetString("assets.local.base_url"),
+		)
+	case BackendNone:
+		return NewNoneStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown asset store backend: %s", name)
+	}
+}
@@ -0,0 +1,106 @@
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const octetStream = "application/octet-stream"
+
+// SniffLength bytes of a file read to detect its content type, see DetectContentType
+const SniffLength = 1024
+
+// extensions of the common content types, others are looked up in the mime tables
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/svg+xml":   ".svg",
+	"image/bmp":       ".bmp",
+	"image/x-icon":    ".ico",
+	"image/avif":      ".avif",
+	"image/heic":      ".heic",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/quicktime": ".mov",
+	"audio/mpeg":      ".mp3",
+	"audio/wav":       ".wav",
+	"application/zip": ".zip",
+	"text/plain":      ".txt",
+}
+
+// DetectContentType the content type of a downloaded file: sniffed from the body,
+// or the Content-Type header of the response, or the extension of the url.
+// The first SniffLength bytes of the body are enough.
+func DetectContentType(body []byte, header, srcUrl string) string {
+	sniffed := mediaType(http.DetectContentType(body))
+	if isSVG(sniffed, body) {
+		return "image/svg+xml"
+	}
+	if sniffed != octetStream && sniffed != "text/plain" {
+		return sniffed
+	}
+
+	if header = mediaType(header); header != "" && header != octetStream && header != "binary/octet-stream" {
+		return header
+	}
+	if u, err := url.Parse(srcUrl); err == nil {
+		if byExt := mediaType(mime.TypeByExtension(path.Ext(u.Path))); byExt != "" {
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// Extension the file extension of the content type, empty if unknown
+func Extension(contentType string) string {
+	if ext, ok := extensions[contentType]; ok {
+		return ext
+	}
+	exts, err := mime.ExtensionsByType(contentType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+// ObjectKey content addressed key of the file, identical files are stored once
+func ObjectKey(body []byte, contentType string) string {
+	sum := sha256.Sum256(body)
+	return DigestKey(sum[:], contentType)
+}
+
+// DigestKey the key of ObjectKey from the sha256 digest of the file,
+// for files hashed while streamed
+func DigestKey(digest []byte, contentType string) string {
+	return hex.EncodeToString(digest) + Extension(contentType)
+}
+
+// mediaType the content type without parameters like charset
+func mediaType(contentType string) string {
+	mediatype, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediatype)
+}
+
+// isSVG svg images are sniffed as xml or plain text
+func isSVG(sniffed string, body []byte) bool {
+	if sniffed != "text/xml" && sniffed != "text/plain" {
+		return false
+	}
+	head := body
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	return bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
@@ -0,0 +1,94 @@
+package assets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalRoute path transbot serves the objects of the local store under
+const LocalRoute = "/assets"
+
+// LocalStore storing objects in a local directory served by transbot itself
+type LocalStore struct {
+	// Dir directory of the objects
+	Dir     string
+	baseURL string
+}
+
+// NewLocalStore
+// @Pararm baseURL, public url transbot is reached at, objects are served under LocalRoute
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if dir == "" || baseURL == "" {
+		return nil, errors.New("local asset store: dir and base_url are required")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("create asset dir error: %w", err)
+	}
+	return &LocalStore{Dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *LocalStore) Name() string {
+	return BackendLocal
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (string, bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("stat object error: %w", err)
+	}
+	return s.objectURL(key), true, nil
+}
+
+// Put the content type is not stored, objects are served by the type of their extension
+func (s *LocalStore) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	// written aside first, readers never see a partial file. Every writer has its
+	// own temporary file, jobs may store the same content at the same time
+	tmp, err := os.CreateTemp(s.Dir, "."+key+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("write object error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, body)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("write object error: %w", err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", fmt.Errorf("write object error: %w", err)
+	}
+	return s.objectURL(key), nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return "", fmt.Errorf("invalid object key: %s", key)
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+func (s *LocalStore) objectURL(key string) string {
+	return s.baseURL + LocalRoute + "/" + key
+}
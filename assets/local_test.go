@@ -0,0 +1,102 @@
+package assets
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLocalStorePut(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "https://transbot.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := store.Put(context.Background(), "abc.png", "image/png", bytes.NewReader([]byte("png")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://transbot.example.com/assets/abc.png"; url != want {
+		t.Errorf("Put() url = %s, want %s", url, want)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, "abc.png"))
+	if err != nil || string(body) != "png" {
+		t.Errorf("object not written: %q, %v", body, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %d files", len(entries))
+	}
+	if info, err := os.Stat(filepath.Join(dir, "abc.png")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("object mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestLocalStorePutConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, "http://localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := bytes.Repeat([]byte("content"), 100000)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Put(context.Background(), "same.png", "image/png", bytes.NewReader(body))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Put() error = %v", err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "same.png"))
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("object corrupted: %d bytes, %v", len(got), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d files", len(entries))
+	}
+}
+
+func TestLocalStoreInvalidKey(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "uploads"), "http://localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../escape.png", "a/b.png", `a\b.png`, ".hidden", ".."} {
+		if _, err := store.Put(context.Background(), key, "image/png", bytes.NewReader([]byte("x"))); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.png")); !os.IsNotExist(err) {
+		t.Errorf("object written outside the store dir")
+	}
+}
+
+func TestNewLocalStore(t *testing.T) {
+	if _, err := NewLocalStore("", "http://localhost"); err == nil {
+		t.Error("want an error without dir")
+	}
+	if _, err := NewLocalStore(t.TempDir(), ""); err == nil {
+		t.Error("want an error without base url")
+	}
+}
+
+func TestNoneStore(t *testing.T) {
+	store := NewNoneStore()
+	if _, err := store.Put(context.Background(), "abc.png", "image/png", bytes.NewReader([]byte("x"))); err != ErrNotStored {
+		t.Errorf("Put() error = %v, want ErrNotStored", err)
+	}
+}
@@ -0,0 +1,100 @@
+package assets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Config settings of an S3-compatible bucket
+type S3Config struct {
+	Endpoint string
+	// Region signing region, us-east-1 if empty
+	Region string
+	Key    string
+	Secret string
+	Bucket string
+	// PublicURL base url the objects are read from, <Endpoint>/<Bucket> if empty
+	PublicURL string
+	// PathStyle addressing the bucket in the path instead of the host name,
+	// required by most self-hosted servers like MinIO
+	PathStyle bool
+}
+
+// S3Store storing objects in any S3-compatible bucket, like 4everland, AWS or MinIO
+type S3Store struct {
+	client    *s3.Client
+	bucket    string
+	publicURL string
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 asset store: endpoint and bucket are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		publicURL = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket
+	}
+
+	client := s3.New(s3.Options{
+		Region:       cfg.Region,
+		Credentials:  credentials.NewStaticCredentialsProvider(cfg.Key, cfg.Secret, ""),
+		UsePathStyle: cfg.PathStyle,
+		EndpointResolver: s3.EndpointResolverFunc(func(region string, options s3.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: cfg.Endpoint, HostnameImmutable: cfg.PathStyle}, nil
+		}),
+	})
+	return &S3Store{
+		client:    client,
+		bucket:    cfg.Bucket,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}, nil
+}
+
+func (s *S3Store) Name() string {
+	return BackendS3
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (string, bool, error) {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("head object error: %w", err)
+	}
+	return s.objectURL(key), true, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("put object error: %w", err)
+	}
+	return s.objectURL(key), nil
+}
+
+func (s *S3Store) objectURL(key string) string {
+	return s.publicURL + "/" + key
+}
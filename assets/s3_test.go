@@ -0,0 +1,120 @@
+package assets
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// s3StandIn an in-memory S3 bucket answering path style requests
+type s3StandIn struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	prefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = body
+		s.types[key] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		if _, ok := s.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", s.types[key])
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newS3StandIn(t *testing.T) (*s3StandIn, *httptest.Server) {
+	standIn := &s3StandIn{bucket: "transbot", objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	return standIn, server
+}
+
+func TestS3StorePut(t *testing.T) {
+	standIn, server := newS3StandIn(t)
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Key:       "key",
+		Secret:    "secret",
+		Bucket:    "transbot",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := store.Put(context.Background(), "abc.png", "image/png", bytes.NewReader([]byte("png")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := server.URL + "/transbot/abc.png"; url != want {
+		t.Errorf("Put() url = %s, want %s", url, want)
+	}
+	if string(standIn.objects["abc.png"]) != "png" || standIn.types["abc.png"] != "image/png" {
+		t.Errorf("object not stored: %q, %s", standIn.objects["abc.png"], standIn.types["abc.png"])
+	}
+}
+
+func TestS3StorePublicURL(t *testing.T) {
+	_, server := newS3StandIn(t)
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Key:       "key",
+		Secret:    "secret",
+		Bucket:    "transbot",
+		PublicURL: "https://cdn.example.com/",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := store.Put(context.Background(), "abc.png", "image/png", bytes.NewReader([]byte("png")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://cdn.example.com/abc.png"; url != want {
+		t.Errorf("Put() url = %s, want %s", url, want)
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	if _, err := NewS3Store(S3Config{Bucket: "transbot"}); err == nil {
+		t.Error("want an error without endpoint")
+	}
+	if _, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000"}); err == nil {
+		t.Error("want an error without bucket")
+	}
+}
@@ -0,0 +1,77 @@
+package notionopt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+	log "github.com/sirupsen/logrus"
+)
+
+// SourceCallout a callout linking a translated page to its source page,
+// noting the model and the date of the translation
+func SourceCallout(sourceId, model string, date time.Time) notion.Block {
+	icon := "🌐"
+	return notion.BlockDTO{
+		Type: notion.BlockTypeCallout,
+		Callout: &notion.CalloutBlock{
+			RichText: []notion.RichText{
+				textRun("Machine translated from "),
+				pageMention(sourceId),
+				textRun(fmt.Sprintf(" with model %s on %s.", model, date.Format("2006-01-02"))),
+			},
+			Icon:  &notion.Icon{Type: notion.IconTypeEmoji, Emoji: &icon},
+			Color: notion.ColorGrayBg,
+		},
+	}
+}
+
+// PageLink a paragraph with a label followed by a link to a page
+func PageLink(label, pageId string) notion.Block {
+	return notion.BlockDTO{
+		Type: notion.BlockTypeParagraph,
+		Paragraph: &notion.ParagraphBlock{
+			RichText: []notion.RichText{textRun(label + ": "), pageMention(pageId)},
+		},
+	}
+}
+
+// Toggle a toggle block with the title and children
+func Toggle(title string, children []notion.Block) notion.Block {
+	return notion.BlockDTO{
+		Type: notion.BlockTypeToggle,
+		Toggle: &notion.ToggleBlock{
+			RichText: []notion.RichText{textRun(title)},
+			Children: children,
+		},
+	}
+}
+
+func textRun(text string) notion.RichText {
+	return notion.RichText{
+		Type:      notion.RichTextTypeText,
+		Text:      &notion.Text{Content: text},
+		PlainText: text,
+	}
+}
+
+func pageMention(pageId string) notion.RichText {
+	return notion.RichText{
+		Type: notion.RichTextTypeMention,
+		Mention: &notion.Mention{
+			Type: notion.MentionTypePage,
+			Page: &notion.ID{ID: pageId},
+		},
+	}
+}
+
+// BlockExists returns false if the block is archived or can't be found
+func (n *NotionOperator) BlockExists(blockId string) bool {
+	block, err := n.notionClient.FindBlockByID(context.Background(), blockId)
+	if err != nil {
+		log.Warnf("find block %s error: %s", blockId, err)
+		return false
+	}
+	return !block.Archived()
+}
@@ -0,0 +1,204 @@
+package notionopt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+// BilingualLayout how a source block and its translation are laid out
+type BilingualLayout string
+
+const (
+	// BilingualInterleaved every source block is followed by its translation
+	BilingualInterleaved BilingualLayout = "interleaved"
+	// BilingualColumns every source block and its translation side by side,
+	// in a two-column list
+	BilingualColumns BilingualLayout = "columns"
+)
+
+// BilingualStyle how translated blocks are told apart from the source
+type BilingualStyle struct {
+	// Color of the translated text, like "gray" or "blue_background", empty keeps the colors
+	Color notion.Color
+	// Quote turns translated paragraphs into quotes
+	Quote bool
+}
+
+// Bilingual merging source blocks with their translations into a single page.
+// translations must have the same structure as sources, see CloneBlocks.
+// Blocks whose text is unchanged (images, dividers, ...) appear once,
+// the rows of a table alternate between source and translation.
+// List items keep their numbering, the translation goes below the source item.
+func Bilingual(sources, translations []notion.Block, layout BilingualLayout, style BilingualStyle) ([]notion.Block, error) {
+	if len(sources) != len(translations) {
+		return nil, fmt.Errorf("bilingual: %d source blocks, %d translated blocks", len(sources), len(translations))
+	}
+
+	var result []notion.Block
+	for i := range sources {
+		source, traned := sources[i], translations[i]
+		if blockText(source) == blockText(traned) {
+			// containers like tables and column lists are merged inside
+			children, err := Bilingual(GetChildren(source), GetChildren(traned), BilingualInterleaved, style)
+			if err != nil {
+				return nil, err
+			}
+			err = SetChildren(traned, children)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, traned)
+			continue
+		}
+
+		if layout == BilingualColumns {
+			traned, err := styleTree(traned, style)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, columnPair(source, traned))
+			continue
+		}
+		traned = styleTranslation(traned, style)
+
+		children, err := Bilingual(GetChildren(source), GetChildren(traned), BilingualInterleaved, style)
+		if err != nil {
+			return nil, err
+		}
+		if isListItem(source) {
+			translation := styleTranslation(asParagraph(traned), style)
+			err = SetChildren(source, append([]notion.Block{translation}, children...))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, source)
+			continue
+		}
+		err = SetChildren(traned, children)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, withoutChildren(source), traned)
+	}
+	return result, nil
+}
+
+// Text compared to find translated blocks
+func blockText(block notion.Block) string {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return ""
+	}
+
+	switch dto.Type {
+	case notion.BlockTypeTableRow:
+		var sb strings.Builder
+		for _, cell := range dto.TableRow.Cells {
+			sb.WriteString(GetFullRichtext(cell))
+			sb.WriteByte('\t')
+		}
+		return sb.String()
+	case notion.BlockTypeCode:
+		return GetFullRichtext(dto.Code.RichText)
+	}
+	content, _ := GetBlockContent(block)
+	return content
+}
+
+// styleTranslation coloring the translated text, paragraphs may become quotes
+func styleTranslation(block notion.Block, style BilingualStyle) notion.Block {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return block
+	}
+
+	if style.Color != "" {
+		if dto.Type == notion.BlockTypeTableRow {
+			for i := range dto.TableRow.Cells {
+				colorRichtext(dto.TableRow.Cells[i], style.Color)
+			}
+		} else if richtext, _ := GetRichtext(block); richtext != nil {
+			colorRichtext(*richtext, style.Color)
+		}
+	}
+	if style.Quote && dto.Type == notion.BlockTypeParagraph {
+		dto.Type = notion.BlockTypeQuote
+		dto.Quote = &notion.QuoteBlock{
+			RichText: dto.Paragraph.RichText,
+			Children: dto.Paragraph.Children,
+			Color:    dto.Paragraph.Color,
+		}
+		dto.Paragraph = nil
+	}
+	return dto
+}
+
+// styleTree styling the translated block and all its nested children
+func styleTree(block notion.Block, style BilingualStyle) (notion.Block, error) {
+	children := GetChildren(block)
+	styled := make([]notion.Block, len(children))
+	for i, child := range children {
+		var err error
+		styled[i], err = styleTree(child, style)
+		if err != nil {
+			return nil, err
+		}
+	}
+	block = styleTranslation(block, style)
+	return block, SetChildren(block, styled)
+}
+
+// colorRichtext setting the color of runs using the default color
+func colorRichtext(richText []notion.RichText, color notion.Color) {
+	for i := range richText {
+		annotations := notion.Annotations{}
+		if richText[i].Annotations != nil {
+			annotations = *richText[i].Annotations
+		}
+		if annotations.Color != "" && annotations.Color != notion.ColorDefault {
+			continue
+		}
+		annotations.Color = color
+		richText[i].Annotations = &annotations
+	}
+}
+
+// columnPair the source block and its translation in a two-column list,
+// the list takes the source block id to be found again by SyncBlocks
+func columnPair(source, traned notion.Block) notion.Block {
+	return notion.BlockDTO{
+		BaseBlock: notion.BaseBlock{BID: source.ID()},
+		Type:      notion.BlockTypeColumnList,
+		ColumnList: &notion.ColumnListBlock{
+			Children: []notion.ColumnBlock{
+				{Children: []notion.Block{source}},
+				{Children: []notion.Block{traned}},
+			},
+		},
+	}
+}
+
+func isListItem(block notion.Block) bool {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return false
+	}
+	switch dto.Type {
+	case notion.BlockTypeNumberedListItem, notion.BlockTypeBulletedListItem, notion.BlockTypeToDo:
+		return true
+	default:
+		return false
+	}
+}
+
+// asParagraph returns the text of the block as a paragraph without children
+func asParagraph(block notion.Block) notion.Block {
+	richtext, _ := GetRichtext(block)
+	paragraph := &notion.ParagraphBlock{RichText: []notion.RichText{}}
+	if richtext != nil {
+		paragraph.RichText = *richtext
+	}
+	return notion.BlockDTO{Type: notion.BlockTypeParagraph, Paragraph: paragraph}
+}
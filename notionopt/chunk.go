@@ -0,0 +1,336 @@
+package notionopt
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+// MaxRichtextLength notion limit of the content of a single rich text object,
+// counted in UTF-16 code units
+const MaxRichtextLength = 2000
+
+const (
+	asciiSentenceEnds = ".!?;"
+	wideSentenceEnds  = "。！？；…"
+	sentenceClosers   = "\"')]}”’」』）》"
+)
+
+// TextLength length of the text as counted by notion, in UTF-16 code units
+func TextLength(text string) int {
+	length := 0
+	for _, r := range text {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+// SplitText splitting text into pieces of at most limit UTF-16 code units.
+// Pieces end on sentence boundaries when possible, then on whitespace,
+// a rune or a combining sequence is never split.
+// Joining the pieces gives back the text.
+func SplitText(text string, limit int) []string {
+	if limit <= 0 || TextLength(text) <= limit {
+		return []string{text}
+	}
+
+	var pieces []string
+	var sb strings.Builder
+	size := 0
+	for _, part := range textParts(text, limit) {
+		length := TextLength(part)
+		if size > 0 && size+length > limit {
+			pieces = append(pieces, sb.String())
+			sb.Reset()
+			size = 0
+		}
+		sb.WriteString(part)
+		size += length
+	}
+	if size > 0 {
+		pieces = append(pieces, sb.String())
+	}
+	return pieces
+}
+
+// SplitRichtext splitting text runs longer than MaxRichtextLength
+// into several runs with the same annotations and link
+func SplitRichtext(richText []notion.RichText) []notion.RichText {
+	result := make([]notion.RichText, 0, len(richText))
+	for _, rt := range richText {
+		if rt.Text == nil || TextLength(rt.Text.Content) <= MaxRichtextLength {
+			result = append(result, rt)
+			continue
+		}
+		for _, piece := range SplitText(rt.Text.Content, MaxRichtextLength) {
+			run := rt
+			text := *rt.Text
+			text.Content = piece
+			run.Text = &text
+			run.PlainText = piece
+			result = append(result, run)
+		}
+	}
+	return result
+}
+
+// ChunkMarkup splitting rich text markup (see EncodeRichtext) into chunks of
+// about limit UTF-16 code units, to be translated separately.
+// A styled run crossing a chunk boundary is closed and reopened, so that
+// every chunk is valid markup on its own.
+// The markup is returned as is if it can not be parsed.
+func ChunkMarkup(markup string, limit int) []string {
+	if limit <= 0 || TextLength(markup) <= limit {
+		return []string{markup}
+	}
+	units, ok := parseMarkupUnits(markup)
+	if !ok {
+		return []string{markup}
+	}
+
+	var chunks []string
+	var sb strings.Builder
+	size := 0
+	open := ""
+	closeSpan := func() {
+		if open != "" {
+			fmt.Fprintf(&sb, "</%s>", open)
+			open = ""
+		}
+	}
+	for _, unit := range units {
+		parts := []string{unit.text}
+		if !unit.placeholder {
+			parts = textParts(unit.text, limit)
+		}
+		for _, part := range parts {
+			if !unit.placeholder {
+				part = markupEscaper.Replace(part)
+			}
+			length := TextLength(part)
+			if size > 0 && size+length > limit {
+				closeSpan()
+				chunks = append(chunks, sb.String())
+				sb.Reset()
+				size = 0
+			}
+			if unit.span != open {
+				closeSpan()
+				if unit.span != "" {
+					fmt.Fprintf(&sb, "<%s>", unit.span)
+				}
+				open = unit.span
+			}
+			sb.WriteString(part)
+			size += length
+		}
+	}
+	closeSpan()
+	if sb.Len() > 0 {
+		chunks = append(chunks, sb.String())
+	}
+	return chunks
+}
+
+// JoinChunks joining the translations of chunks made by SplitText or ChunkMarkup.
+// The whitespace ending a source chunk is put back, unless the translated chunk
+// ends with a CJK character.
+func JoinChunks(sources, traned []string) string {
+	var sb strings.Builder
+	for i, chunk := range traned {
+		if i > 0 && i <= len(sources) {
+			sb.WriteString(chunkSeparator(sources[i-1], traned[i-1]))
+		}
+		sb.WriteString(chunk)
+	}
+	return sb.String()
+}
+
+func chunkSeparator(source, traned string) string {
+	plain := StripMarkup(source)
+	sep := plain[len(strings.TrimRightFunc(plain, unicode.IsSpace)):]
+	// the whitespace may sit inside a closing tag, like "text. </s1>"
+	tranedPlain := StripMarkup(traned)
+	if sep == "" || strings.TrimRightFunc(tranedPlain, unicode.IsSpace) != tranedPlain {
+		return ""
+	}
+	if strings.Contains(sep, "\n") {
+		return sep
+	}
+	last, _ := utf8.DecodeLastRuneInString(tranedPlain)
+	if isWideRune(last) {
+		return ""
+	}
+	return sep
+}
+
+// markupUnit a text run or a placeholder of the markup
+type markupUnit struct {
+	// span the styled run tag the text belongs to, like "s1", empty for plain text
+	span string
+	// text unescaped text, or the placeholder tag
+	text        string
+	placeholder bool
+}
+
+func parseMarkupUnits(markup string) ([]markupUnit, bool) {
+	var units []markupUnit
+	span := ""
+	rest := markup
+	for rest != "" {
+		start := strings.IndexByte(rest, '<')
+		if start < 0 {
+			start = len(rest)
+		}
+		if start > 0 {
+			units = append(units, markupUnit{span: span, text: html.UnescapeString(rest[:start])})
+		}
+		rest = rest[start:]
+		if rest == "" {
+			break
+		}
+
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return nil, false
+		}
+		tag := rest[1:end]
+		rest = rest[end+1:]
+		switch {
+		case strings.HasPrefix(tag, "m") && strings.HasSuffix(tag, "/"):
+			units = append(units, markupUnit{text: "<" + tag + ">", placeholder: true})
+		case strings.HasPrefix(tag, "/s"):
+			span = ""
+		case strings.HasPrefix(tag, "s"):
+			span = tag
+		default:
+			return nil, false
+		}
+	}
+	return units, true
+}
+
+// textParts splitting text into sentences,
+// sentences longer than limit are split further
+func textParts(text string, limit int) []string {
+	var parts []string
+	for _, sentence := range sentences(text) {
+		parts = append(parts, splitLong(sentence, limit)...)
+	}
+	return parts
+}
+
+// sentences splitting text after every sentence end,
+// the whitespace following a sentence stays with it
+func sentences(text string) []string {
+	const (
+		none = iota
+		// ascii terminator seen, a break needs whitespace
+		terminated
+		// break before the next non-space rune
+		pending
+	)
+
+	var result []string
+	start, state := 0, none
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if state == pending && !space && !strings.ContainsRune(sentenceClosers, r) {
+			result = append(result, text[start:i])
+			start, state = i, none
+		}
+
+		switch {
+		case space:
+			if r == '\n' || state == terminated {
+				state = pending
+			}
+		case strings.ContainsRune(asciiSentenceEnds, r):
+			if state != pending {
+				state = terminated
+			}
+		case strings.ContainsRune(wideSentenceEnds, r):
+			state = pending
+		case strings.ContainsRune(sentenceClosers, r):
+			// closing quotes and brackets stay with the sentence
+		default:
+			state = none
+		}
+	}
+	if start < len(text) {
+		result = append(result, text[start:])
+	}
+	return result
+}
+
+// splitLong splitting text longer than limit on the last whitespace,
+// or on the last rune boundary outside of a combining sequence
+func splitLong(text string, limit int) []string {
+	var parts []string
+	for TextLength(text) > limit {
+		end := prefixEnd(text, limit)
+		cut := strings.LastIndexFunc(text[:end], unicode.IsSpace)
+		if cut >= 0 {
+			_, size := utf8.DecodeRuneInString(text[cut:])
+			cut += size
+		}
+		if cut <= end/2 {
+			cut = safeCut(text, end)
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// prefixEnd byte length of the longest prefix within limit, at least one rune
+func prefixEnd(text string, limit int) int {
+	end, length := 0, 0
+	for i, r := range text {
+		length += TextLength(string(r))
+		if length > limit {
+			break
+		}
+		end = i + utf8.RuneLen(r)
+	}
+	if end == 0 {
+		_, end = utf8.DecodeRuneInString(text)
+	}
+	return end
+}
+
+// safeCut moving the cut backward until it doesn't split a combining sequence,
+// like a letter and its accents or an emoji sequence
+func safeCut(text string, end int) int {
+	for cut := end; cut > 0; {
+		next, _ := utf8.DecodeRuneInString(text[cut:])
+		prev, size := utf8.DecodeLastRuneInString(text[:cut])
+		if !isCombining(next) && prev != '\u200d' {
+			return cut
+		}
+		cut -= size
+	}
+	return end
+}
+
+func isCombining(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector) ||
+		r == '\u200d' || (r >= 0x1f3fb && r <= 0x1f3ff)
+}
+
+// Scripts written without spaces between sentences
+func isWideRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
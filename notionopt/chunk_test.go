@@ -0,0 +1,183 @@
+package notionopt
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+func TestTextLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"你好", 2},
+		{"😀", 2},
+		{"👨‍👩‍👧", 8},
+		{"e\u0301", 2},
+	}
+	for _, tt := range tests {
+		if got := TextLength(tt.text); got != tt.want {
+			t.Errorf("TextLength(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+	}{
+		{"short", "Hello world.", 20},
+		{"sentences", strings.Repeat("One sentence here. ", 300), MaxRichtextLength},
+		{"wide sentences", strings.Repeat("这是一个句子。", 700), MaxRichtextLength},
+		{"no boundaries", strings.Repeat("x", 4500), MaxRichtextLength},
+		{"emoji at boundary", strings.Repeat("a", 1999) + strings.Repeat("😀", 10), MaxRichtextLength},
+		{"emoji only", strings.Repeat("😀", 2500), MaxRichtextLength},
+		{"zwj at boundary", strings.Repeat("a", 1995) + strings.Repeat("👨‍👩‍👧", 3), MaxRichtextLength},
+		{"combining at boundary", strings.Repeat("a", 1999) + "e\u0301" + strings.Repeat("b", 10), MaxRichtextLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pieces := SplitText(tt.text, tt.limit)
+			if joined := strings.Join(pieces, ""); joined != tt.text {
+				t.Fatalf("joined pieces differ from the text")
+			}
+			for i, piece := range pieces {
+				if piece == "" {
+					t.Errorf("piece %d is empty", i)
+				}
+				if n := TextLength(piece); n > tt.limit {
+					t.Errorf("piece %d has %d units, limit %d", i, n, tt.limit)
+				}
+				if !utf8.ValidString(piece) {
+					t.Errorf("piece %d is not valid UTF-8", i)
+				}
+				if i > 0 {
+					first, _ := utf8.DecodeRuneInString(piece)
+					if first == '\u200d' || first == '\u0301' {
+						t.Errorf("piece %d starts inside a combining sequence", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSplitTextSentenceBoundary(t *testing.T) {
+	text := strings.Repeat("a", 1500) + ". " + strings.Repeat("b", 1000)
+	pieces := SplitText(text, MaxRichtextLength)
+	if len(pieces) != 2 || pieces[0] != strings.Repeat("a", 1500)+". " {
+		t.Errorf("want a split after the sentence end, got pieces of %d, %d", len(pieces[0]), len(pieces)-1)
+	}
+}
+
+func TestSplitRichtext(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	content := strings.Repeat("😀", 1500)
+	split := SplitRichtext([]notion.RichText{textRich("short", nil), textRich(content, bold)})
+	if len(split) != 3 {
+		t.Fatalf("got %d runs, want 3", len(split))
+	}
+	var sb strings.Builder
+	for _, rt := range split[1:] {
+		if rt.Annotations != bold {
+			t.Errorf("split run lost its annotations")
+		}
+		if TextLength(rt.Text.Content) > MaxRichtextLength {
+			t.Errorf("split run has %d units", TextLength(rt.Text.Content))
+		}
+		sb.WriteString(rt.Text.Content)
+	}
+	if sb.String() != content {
+		t.Errorf("split runs differ from the content")
+	}
+}
+
+func TestChunkMarkup(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	original := []notion.RichText{
+		textRich(strings.Repeat("Plain & simple. ", 100), nil),
+		textRich(strings.Repeat("Bold <text> 😀. ", 200), bold),
+		mentionRich("p1"),
+		textRich(strings.Repeat("Tail. ", 50), nil),
+	}
+	markup := EncodeRichtext(original)
+	chunks := ChunkMarkup(markup, MaxRichtextLength)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+
+	var plain strings.Builder
+	for i, chunk := range chunks {
+		if n := TextLength(StripMarkup(chunk)); n > MaxRichtextLength {
+			t.Errorf("chunk %d has %d units", i, n)
+		}
+		// every chunk decodes on its own
+		if _, err := DecodeRichtext(original, chunk); err != nil {
+			t.Errorf("chunk %d is not valid markup: %v", i, err)
+		}
+		plain.WriteString(StripMarkup(chunk))
+	}
+	if plain.String() != StripMarkup(markup) {
+		t.Errorf("chunks differ from the markup")
+	}
+
+	// translating every chunk as is gives back the original runs
+	decoded, err := DecodeRichtext(original, JoinChunks(chunks, chunks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := richtextText(decoded), richtextText(original); got != want {
+		t.Errorf("round trip differs from the original text")
+	}
+}
+
+func TestChunkMarkupInvalid(t *testing.T) {
+	markup := "<b>" + strings.Repeat("x", 3000) + "</b>"
+	chunks := ChunkMarkup(markup, MaxRichtextLength)
+	if len(chunks) != 1 || chunks[0] != markup {
+		t.Errorf("invalid markup should be returned as is")
+	}
+}
+
+func TestJoinChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		traned  []string
+		want    string
+	}{
+		{"space kept", []string{"Hello. ", "World."}, []string{"Bonjour.", "Monde."}, "Bonjour. Monde."},
+		{"no double space", []string{"Hello. ", "World."}, []string{"Bonjour. ", "Monde."}, "Bonjour. Monde."},
+		{"newline kept", []string{"Hello.\n", "World."}, []string{"你好。", "世界。"}, "你好。\n世界。"},
+		{"wide end", []string{"Hello. ", "World."}, []string{"你好。", "世界。"}, "你好。世界。"},
+		{"no separator", []string{"Hello", "World"}, []string{"A", "B"}, "AB"},
+		{"markup", []string{"<s0>Hello. </s0>", "<s0>World.</s0>"}, []string{"<s0>Hola.</s0>", "<s0>Mundo.</s0>"}, "<s0>Hola.</s0> <s0>Mundo.</s0>"},
+		{"space in span", []string{"<s0>Hello. </s0>", "<s0>World.</s0>"}, []string{"<s0>Hola. </s0>", "<s0>Mundo.</s0>"}, "<s0>Hola. </s0><s0>Mundo.</s0>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JoinChunks(tt.sources, tt.traned); got != tt.want {
+				t.Errorf("JoinChunks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func richtextText(richText []notion.RichText) string {
+	var sb strings.Builder
+	for _, rt := range richText {
+		if rt.Text != nil {
+			sb.WriteString(rt.Text.Content)
+		} else {
+			sb.WriteString(rt.PlainText)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,136 @@
+package notionopt
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+// Comment syntaxes of code block languages, as named by notion.
+// String literals are matched too, so that comment markers inside them are skipped.
+var (
+	slashCommentReg = regexp.MustCompile(`"(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'|` + "`[^`]*`" + `|//[^\n]*|/\*[\s\S]*?\*/`)
+	hashCommentReg  = regexp.MustCompile(`"(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'|#[^\n]*`)
+	dashCommentReg  = regexp.MustCompile(`"(?:\\.|[^"\\\n])*"|'(?:''|[^'\n])*'|--[^\n]*`)
+
+	codeCommentRegs = map[string]*regexp.Regexp{
+		"c":            slashCommentReg,
+		"c++":          slashCommentReg,
+		"c#":           slashCommentReg,
+		"dart":         slashCommentReg,
+		"f#":           slashCommentReg,
+		"go":           slashCommentReg,
+		"java":         slashCommentReg,
+		"javascript":   slashCommentReg,
+		"kotlin":       slashCommentReg,
+		"less":         slashCommentReg,
+		"objective-c":  slashCommentReg,
+		"php":          slashCommentReg,
+		"rust":         slashCommentReg,
+		"scala":        slashCommentReg,
+		"scss":         slashCommentReg,
+		"solidity":     slashCommentReg,
+		"swift":        slashCommentReg,
+		"typescript":   slashCommentReg,
+		"bash":         hashCommentReg,
+		"coffeescript": hashCommentReg,
+		"docker":       hashCommentReg,
+		"elixir":       hashCommentReg,
+		"julia":        hashCommentReg,
+		"makefile":     hashCommentReg,
+		"perl":         hashCommentReg,
+		"powershell":   hashCommentReg,
+		"python":       hashCommentReg,
+		"r":            hashCommentReg,
+		"ruby":         hashCommentReg,
+		"shell":        hashCommentReg,
+		"yaml":         hashCommentReg,
+		"elm":          dashCommentReg,
+		"haskell":      dashCommentReg,
+		"lua":          dashCommentReg,
+		"sql":          dashCommentReg,
+	}
+
+	commentStartReg    = regexp.MustCompile(`^(//+|/\*+|#+|--)[ \t]*`)
+	blockCommentEndReg = regexp.MustCompile(`\s*\*+/$`)
+)
+
+// codeText a code block split into code and comment parts,
+// shared by the comment segments of the block
+type codeText struct {
+	parts []string
+}
+
+// codeComment a comment of a code block, the comment markers are not part of it
+type codeComment struct {
+	code  *codeText
+	index int
+	// line comments must stay on a single line
+	line bool
+}
+
+func (c *codeComment) text() string {
+	return c.code.parts[c.index]
+}
+
+// apply replacing the comment by its translation and rewriting the whole code
+func (c *codeComment) apply(richtext *[]notion.RichText, traned string) error {
+	traned = strings.TrimSpace(traned)
+	if c.line {
+		traned = strings.Join(strings.Fields(traned), " ")
+	}
+	c.code.parts[c.index] = traned
+	return ReplaceRichtext(richtext, strings.Join(c.code.parts, ""))
+}
+
+// codeSegments returns a segment for every comment of the code block,
+// the code itself is left untouched
+func codeSegments(block notion.Block, code *notion.CodeBlock, index int) []Segment {
+	if code.Language == nil {
+		return nil
+	}
+	reg, ok := codeCommentRegs[*code.Language]
+	if !ok {
+		return nil
+	}
+
+	text := GetFullRichtext(code.RichText)
+	ct := &codeText{}
+	var segments []Segment
+	last := 0
+	for _, loc := range reg.FindAllStringIndex(text, -1) {
+		match := text[loc[0]:loc[1]]
+		start := commentStartReg.FindString(match)
+		if start == "" || strings.HasPrefix(match, "#!") {
+			// string literal or shebang
+			continue
+		}
+		body := match[len(start):]
+		if strings.HasPrefix(start, "/*") {
+			body = strings.TrimSuffix(body, blockCommentEndReg.FindString(body))
+		}
+		body = strings.TrimRightFunc(body, unicode.IsSpace)
+		if strings.IndexFunc(body, unicode.IsLetter) < 0 {
+			continue
+		}
+
+		bodyStart := loc[0] + len(start)
+		ct.parts = append(ct.parts, text[last:bodyStart])
+		segments = append(segments, Segment{
+			Block:      block,
+			BlockIndex: index,
+			RichText:   &code.RichText,
+			comment: &codeComment{
+				code:  ct,
+				index: len(ct.parts),
+				line:  !strings.HasPrefix(start, "/*"),
+			},
+		})
+		ct.parts = append(ct.parts, body)
+		last = bodyStart + len(body)
+	}
+	ct.parts = append(ct.parts, text[last:])
+	return segments
+}
@@ -1,74 +1,74 @@
 package notionopt
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/assets"
+	"github.com/permadao/transbot/store"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/cryptowizard0/notion2arweave/utils"
 	"github.com/go-resty/resty/v2"
+	"github.com/tidwall/gjson"
 )
 
+// Max blocks per append block children request
+const maxBlocksPerAppend = 100
+
 // NotionOperator Implementation of INotionOperator
-// Not considering concurrency
+// Safe to share between workers: the clients are stateless apart from the
+// retry transport, whose rate limiter is shared on purpose so that all workers
+// stay within the notion rate limit together, the title property cache
+// is guarded by titleMu, and the store of re-hosted files is safe for concurrent use.
+// Calls for the same page are not ordered against each other, callers serialize
+// those themselves.
 type NotionOperator struct {
 	authToken    string
 	httpClient   *resty.Client
 	notionClient *notion.Client
-	s3Client     *s3.Client
-	s3Endpoint   string
-	s3Key        string
-	s3Secret     string
-	s3Bucket     string
+	assets       assets.AssetStore
+	// db caches the re-hosted files, may be nil
+	db *store.Store
+
+	// title property names by database id
+	titleMu    sync.Mutex
+	titleProps map[string]string
 }
 
 // CreateNotionOperator
-func CreateNotionOperator(auth string) *NotionOperator {
+// @Pararm assetStore, images and files uploaded to notion are re-hosted there
+// @Pararm db, store remembering the re-hosted files, may be nil
+func CreateNotionOperator(auth string, assetStore assets.AssetStore, db *store.Store) *NotionOperator {
+	// retries and rate limit, shared by both clients
+	transport := newRetryTransport()
+
 	// http client
 	client := resty.New()
+	client.SetTransport(transport)
 	client.SetHeader("Accept", "application/json").
 		SetHeader("Notion-Version", viper.GetString("notion.version")).
 		SetAuthToken(auth).
 		SetBaseURL(viper.GetString("notion.base_url"))
 
-	// s3 client
-	key := viper.GetString("4everland.key")
-	secret := viper.GetString("4everland.secret")
-	endpoint := viper.GetString("4everland.endpoint")
-	bucket := viper.GetString("4everland.bucket_name")
-	token := ""
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(key, secret, token)),
-		config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-			return aws.Endpoint{
-				URL: endpoint,
-			}, nil
-		})),
-	)
-	if err != nil {
-		log.Fatalf("unable to load s3 config, %v", err)
-	}
-	s3client := s3.NewFromConfig(cfg)
-
 	return &NotionOperator{
 		authToken:    auth,
 		httpClient:   client,
-		notionClient: notion.NewClient(auth),
-		s3Client:     s3client,
-		s3Key:        key,
-		s3Secret:     secret,
-		s3Endpoint:   endpoint,
-		s3Bucket:     bucket,
+		notionClient: notion.NewClient(auth, notion.WithHTTPClient(&http.Client{Transport: transport})),
+		assets:       assetStore,
+		db:           db,
+		titleProps:   make(map[string]string),
 	}
 }
 
@@ -85,8 +85,8 @@ func (n *NotionOperator) FetchPage(uuid string) (content string, err error) {
 		return "", err
 	}
 
-	// 2. get child blocks
-	strPageContent, err := n.fetchPageContent(uuid, "")
+	// 2. get child blocks, including nested children
+	strPageContent, err := n.fetchBlockTree(uuid)
 	if err != nil {
 		log.Error("fetch content error:", err.Error())
 		return "", err
@@ -105,17 +105,9 @@ func (n *NotionOperator) FetchPage(uuid string) (content string, err error) {
 func (n *NotionOperator) UploadPage(parentId string, page *NotionPage) (uuid string, err error) {
 	log.WithField("parent", parentId).Info("notion operator: upload page")
 
-	var title []notion.RichText
-	pageProp, ok := page.PageInfo.Properties.(notion.PageProperties)
-	if ok {
-		title = pageProp.Title.Title
-	} else {
-		// try to covert to (notion.DatabasePageProperty)
-		dbProp, ok := page.PageInfo.Properties.(notion.DatabasePageProperties)
-		if !ok {
-			return "", fmt.Errorf("convert page preperites error")
-		}
-		title = dbProp["Name"].Title
+	title, err := n.PageTitle(page)
+	if err != nil {
+		return "", err
 	}
 	newPageParams := notion.CreatePageParams{
 		ParentType: notion.ParentTypePage,
@@ -131,18 +123,10 @@ func (n *NotionOperator) UploadPage(parentId string, page *NotionPage) (uuid str
 		return "", err
 	}
 
-	// upload content blocks, Max 100 per request
-	blocks := page.PageContent.Results
-	for i := 0; (i * 100) < len(blocks); i++ {
-		starindex := i * 100
-		endindex := i*100 + 100
-		if endindex > len(blocks) {
-			endindex = len(blocks)
-		}
-		_, err = n.notionClient.AppendBlockChildren(context.Background(), newPage.ID, blocks[starindex:endindex])
-		if err != nil {
-			return "", err
-		}
+	// upload content blocks with their children
+	err = n.appendBlocks(newPage.ID, page.PageContent.Results)
+	if err != nil {
+		return "", err
 	}
 
 	return newPage.ID, nil
@@ -156,41 +140,66 @@ func (n *NotionOperator) Content2NotionPage(srcContent string) (*NotionPage, err
 		return nil, err
 	}
 	log.Info("Blocks count: ", len(page.PageContent.Results))
-	var tmpBlocks []notion.Block
 
-	for _, block := range page.PageContent.Results {
-		dto, ok := block.(notion.BlockDTO)
-		if !ok {
-			return nil, fmt.Errorf("convert to notion.BlockDTO failed1")
+	// nested children are not part of notion.BlockDTO, walk the raw json instead
+	tmpBlocks, err := n.convertBlocks(gjson.Get(srcContent, "page_content.results"))
+	if err != nil {
+		return nil, err
+	}
+	page.PageContent.Results = tmpBlocks
+
+	return &page, nil
+}
+
+// convertBlocks converting raw json blocks to notion blocks recursively.
+// Unsupported blocks are dropped, images are re-hosted.
+func (n *NotionOperator) convertBlocks(results gjson.Result) ([]notion.Block, error) {
+	var tmpBlocks []notion.Block
+	for _, raw := range results.Array() {
+		var dto notion.BlockDTO
+		err := json.Unmarshal([]byte(raw.Raw), &dto)
+		if err != nil {
+			return nil, err
 		}
 		if !IsSupported(&dto) {
 			continue
 		}
-		//if dto.Image != nil && dto.Image.Type == notion.FileTypeFile {
-		if dto.Type == notion.BlockTypeImage {
+		var block notion.Block = dto
+		switch dto.Type {
+		case notion.BlockTypeImage:
 			block = n.ConvertImageBlock(&dto)
+		case notion.BlockTypeFile, notion.BlockTypePDF, notion.BlockTypeVideo:
+			block = n.ConvertFileBlock(&dto)
+		}
+
+		children := raw.Get("children.results")
+		if children.Exists() {
+			childBlocks, err := n.convertBlocks(children)
+			if err != nil {
+				return nil, err
+			}
+			err = SetChildren(block, childBlocks)
+			if err != nil {
+				return nil, err
+			}
 		}
 		tmpBlocks = append(tmpBlocks, block)
 	}
-	page.PageContent.Results = tmpBlocks
-
-	return &page, nil
+	return tmpBlocks, nil
 }
 
-func (n *NotionOperator) CreateNewPage(parentId string, page *NotionPage) (uuid string, err error) {
+// CreateNewPage creating an empty page with the title, icon and cover of the page,
+// as a child page or as a row of a database, see CreateDatabaseRow
+// @Pararm parentType, notion.ParentTypePage or notion.ParentTypeDatabase, see ParentType
+func (n *NotionOperator) CreateNewPage(parentType notion.ParentType, parentId string, page *NotionPage) (uuid string, err error) {
+	if parentType == notion.ParentTypeDatabase {
+		return n.CreateDatabaseRow(parentId, page)
+	}
 	log.WithField("parent", parentId).Info("notion operator: create page")
 
-	var title []notion.RichText
-	pageProp, ok := page.PageInfo.Properties.(notion.PageProperties)
-	if ok {
-		title = pageProp.Title.Title
-	} else {
-		// try to covert to (notion.DatabasePageProperty)
-		dbProp, ok := page.PageInfo.Properties.(notion.DatabasePageProperties)
-		if !ok {
-			return "", fmt.Errorf("convert page preperites error")
-		}
-		title = dbProp["Name"].Title
+	title, err := n.PageTitle(page)
+	if err != nil {
+		return "", err
 	}
 	newPageParams := notion.CreatePageParams{
 		ParentType: notion.ParentTypePage,
@@ -208,12 +217,327 @@ func (n *NotionOperator) CreateNewPage(parentId string, page *NotionPage) (uuid
 	return newPage.ID, nil
 }
 
+// ParentType returns whether the id is a database or a page
+func (n *NotionOperator) ParentType(id string) (notion.ParentType, error) {
+	_, err := n.notionClient.FindDatabaseByID(context.Background(), id)
+	if err == nil {
+		return notion.ParentTypeDatabase, nil
+	}
+	_, pageErr := n.notionClient.FindPageByID(context.Background(), id)
+	if pageErr == nil {
+		return notion.ParentTypePage, nil
+	}
+	return "", fmt.Errorf("%w: %s, %s", ErrUnknownParent, err.Error(), pageErr.Error())
+}
+
+// PageTitle returns the title of a page or database row, see TitleProperty
+func (n *NotionOperator) PageTitle(page *NotionPage) ([]notion.RichText, error) {
+	switch props := page.PageInfo.Properties.(type) {
+	case notion.PageProperties:
+		return props.Title.Title, nil
+	case notion.DatabasePageProperties:
+		name, err := n.TitleProperty(page)
+		if err != nil {
+			return nil, err
+		}
+		return props[name].Title, nil
+	default:
+		return nil, fmt.Errorf("convert page preperites error")
+	}
+}
+
+// SetPageTitle replacing the title of a page or database row
+func (n *NotionOperator) SetPageTitle(page *NotionPage, title []notion.RichText) error {
+	switch props := page.PageInfo.Properties.(type) {
+	case notion.PageProperties:
+		props.Title.Title = title
+		page.PageInfo.Properties = props
+	case notion.DatabasePageProperties:
+		name, err := n.TitleProperty(page)
+		if err != nil {
+			return err
+		}
+		prop := props[name]
+		prop.Title = title
+		props[name] = prop
+	default:
+		return fmt.Errorf("convert page preperites error")
+	}
+	return nil
+}
+
+// TitleProperty returns the name of the title property of a database row.
+// The property configured in <notion.title_properties> for the database wins,
+// then the property of type title of the page, then of the database schema.
+func (n *NotionOperator) TitleProperty(page *NotionPage) (string, error) {
+	props, ok := page.PageInfo.Properties.(notion.DatabasePageProperties)
+	if !ok {
+		return "", fmt.Errorf("convert page preperites error")
+	}
+	dbId := page.PageInfo.Parent.DatabaseID
+
+	for id, name := range viper.GetStringMapString("notion.title_properties") {
+		if NormalizeID(id) != NormalizeID(dbId) {
+			continue
+		}
+		if prop, ok := props[name]; !ok || prop.Type != notion.DBPropTypeTitle {
+			return "", fmt.Errorf("%w: configured property %s", ErrNoTitleProperty, name)
+		}
+		return name, nil
+	}
+
+	for name, prop := range props {
+		if prop.Type == notion.DBPropTypeTitle {
+			return name, nil
+		}
+	}
+
+	if dbId == "" {
+		return "", ErrNoTitleProperty
+	}
+	name, err := n.schemaTitleProperty(dbId)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := props[name]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoTitleProperty, name)
+	}
+	return name, nil
+}
+
+// schemaTitleProperty returns the title property of the database schema, cached
+func (n *NotionOperator) schemaTitleProperty(dbId string) (string, error) {
+	n.titleMu.Lock()
+	name, ok := n.titleProps[NormalizeID(dbId)]
+	n.titleMu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	db, err := n.notionClient.FindDatabaseByID(context.Background(), dbId)
+	if err != nil {
+		return "", err
+	}
+	for name, prop := range db.Properties {
+		if prop.Type != notion.DBPropTypeTitle {
+			continue
+		}
+		n.titleMu.Lock()
+		n.titleProps[NormalizeID(dbId)] = name
+		n.titleMu.Unlock()
+		return name, nil
+	}
+	return "", ErrNoTitleProperty
+}
+
+// NormalizeID notion ids are accepted with or without dashes
+func NormalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+// CreateDatabaseRow creating the page as a new row of the database.
+// The title goes to the title property of the database, other properties of a row
+// are copied by name, those missing in the database, with another type or read only are skipped.
+func (n *NotionOperator) CreateDatabaseRow(dbId string, page *NotionPage) (uuid string, err error) {
+	log.WithField("database", dbId).Info("notion operator: create database row")
+
+	values, err := n.rowProperties(dbId, page)
+	if err != nil {
+		return "", err
+	}
+	body := map[string]interface{}{
+		"parent":     map[string]string{"database_id": dbId},
+		"properties": values,
+	}
+	if page.PageInfo.Icon != nil {
+		body["icon"] = page.PageInfo.Icon
+	}
+	if page.PageInfo.Cover != nil {
+		body["cover"] = page.PageInfo.Cover
+	}
+
+	resp, err := n.httpClient.R().SetBody(body).Post("/v1/pages")
+	if err != nil {
+		log.Error("post request error:", err.Error())
+		return "", err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		utils.LogResp_Error(resp)
+		return "", fmt.Errorf(resp.String())
+	}
+	return gjson.Get(resp.String(), "id").String(), nil
+}
+
+// UpdateTranslatedPage replacing the title, icon and cover of a page created by
+// CreateNewPage, or the properties of a row created by CreateDatabaseRow
+// @Pararm dbId, database of the row, empty for a page
+func (n *NotionOperator) UpdateTranslatedPage(pageId, dbId string, page *NotionPage) error {
+	log.WithField("uuid", pageId).Info("notion operator: update page")
+
+	var values map[string]interface{}
+	if dbId != "" {
+		var err error
+		values, err = n.rowProperties(dbId, page)
+		if err != nil {
+			return err
+		}
+	} else {
+		title, err := n.PageTitle(page)
+		if err != nil {
+			return err
+		}
+		values = map[string]interface{}{
+			"title": map[string]interface{}{"title": title},
+		}
+	}
+	body := map[string]interface{}{"properties": values}
+	if page.PageInfo.Icon != nil {
+		body["icon"] = page.PageInfo.Icon
+	}
+	if page.PageInfo.Cover != nil {
+		body["cover"] = page.PageInfo.Cover
+	}
+
+	resp, err := n.httpClient.R().SetBody(body).Patch("/v1/pages/" + pageId)
+	if err != nil {
+		log.Error("patch request error:", err.Error())
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		utils.LogResp_Error(resp)
+		return fmt.Errorf(resp.String())
+	}
+	return nil
+}
+
+// UpdatePageProperty setting a single property of a database row
+// @Pararm value, the property value, like {"select": {"name": "Done"}}
+// @Return lastEdited, last edited time of the row after the update
+func (n *NotionOperator) UpdatePageProperty(pageId, name string, value interface{}) (lastEdited time.Time, err error) {
+	body := map[string]interface{}{
+		"properties": map[string]interface{}{name: value},
+	}
+	resp, err := n.httpClient.R().SetBody(body).Patch("/v1/pages/" + pageId)
+	if err != nil {
+		log.Error("patch request error:", err.Error())
+		return time.Time{}, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		utils.LogResp_Error(resp)
+		return time.Time{}, fmt.Errorf(resp.String())
+	}
+	return time.Parse(time.RFC3339, gjson.Get(resp.String(), "last_edited_time").String())
+}
+
+// rowProperties property values of the page for a row of the database,
+// see CreateDatabaseRow
+func (n *NotionOperator) rowProperties(dbId string, page *NotionPage) (map[string]interface{}, error) {
+	db, err := n.notionClient.FindDatabaseByID(context.Background(), dbId)
+	if err != nil {
+		return nil, err
+	}
+	title, err := n.PageTitle(page)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	for name, schema := range db.Properties {
+		if schema.Type == notion.DBPropTypeTitle {
+			values[name] = map[string]interface{}{"title": title}
+		}
+	}
+	props, ok := page.PageInfo.Properties.(notion.DatabasePageProperties)
+	if !ok {
+		// a page has its title only
+		return values, nil
+	}
+	for name, prop := range props {
+		schema, ok := db.Properties[name]
+		if !ok || schema.Type != prop.Type || prop.Type == notion.DBPropTypeTitle {
+			continue
+		}
+		value, ok := PropertyValue(prop)
+		if !ok {
+			continue
+		}
+		values[name] = map[string]interface{}{string(prop.Type): value}
+	}
+	return values, nil
+}
+
+// AppendBlockChildren appending a block and all its nested children to the parent
 func (n *NotionOperator) AppendBlockChildren(parentId string, block notion.Block) error {
-	blocks := []notion.Block{block}
-	_, err := n.notionClient.AppendBlockChildren(context.Background(), parentId, blocks)
+	return n.appendBlocks(parentId, []notion.Block{block})
+}
+
+// appendBlocks appending blocks and all their nested children to the parent.
+// Notion accepts at most 100 blocks and two levels of nesting per request,
+// so every block is sent without children and its children are appended
+// to the newly created block afterwards, see uploadBlock.
+func (n *NotionOperator) appendBlocks(parentId string, blocks []notion.Block) error {
+	_, err := n.insertBlocks(parentId, "", blocks, blockKeys(blocks))
 	return err
 }
 
+// childBlockIDs returns the ids of the children of a block, in order
+func (n *NotionOperator) childBlockIDs(blockId string) ([]string, error) {
+	var ids []string
+	query := &notion.PaginationQuery{PageSize: maxBlocksPerAppend}
+	for {
+		resp, err := n.notionClient.FindBlockChildrenByID(context.Background(), blockId, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range resp.Results {
+			ids = append(ids, block.ID())
+		}
+		if !resp.HasMore || resp.NextCursor == nil {
+			return ids, nil
+		}
+		query.StartCursor = *resp.NextCursor
+	}
+}
+
+// QueryDatabase querying all pages of a database matching the query
+// @Pararm query, filter and sorts, may be nil
+func (n *NotionOperator) QueryDatabase(dbId string, query *notion.DatabaseQuery) ([]notion.Page, error) {
+	log.WithField("database", dbId).Info("notion operator: query database")
+
+	q := notion.DatabaseQuery{}
+	if query != nil {
+		q = *query
+	}
+	var pages []notion.Page
+	for {
+		resp, err := n.notionClient.QueryDatabase(context.Background(), dbId, &q)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, resp.Results...)
+		if !resp.HasMore || resp.NextCursor == nil {
+			break
+		}
+		q.StartCursor = *resp.NextCursor
+	}
+	return pages, nil
+}
+
+// FindPage returns the page or database row, without its content
+func (n *NotionOperator) FindPage(pageId string) (notion.Page, error) {
+	return n.notionClient.FindPageByID(context.Background(), pageId)
+}
+
+// CurrentUserID id of the bot user of the integration,
+// the last editor of the pages it writes to
+func (n *NotionOperator) CurrentUserID() (string, error) {
+	user, err := n.notionClient.FindCurrentUser(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
 // ========================================================================
 // fetchPageInfo
 func (n *NotionOperator) fetchPageInfo(uuid string) (content string, err error) {
@@ -247,6 +571,39 @@ func (n *NotionOperator) fetchPageInfoByNotionSdk(uuid string) (content string,
 	return string(jsonPage), nil
 }
 
+// fetchBlockTree fetching child blocks of a block recursively.
+// Children of a block are attached to its json as "children",
+// in the same format as the top level content.
+func (n *NotionOperator) fetchBlockTree(uuid string) (content string, err error) {
+	content, err = n.fetchPageContent(uuid, "")
+	if err != nil {
+		return "", err
+	}
+
+	results := gjson.Get(content, "results").Array()
+	blocks := make([]string, len(results))
+	nested := false
+	for i, block := range results {
+		blocks[i] = block.Raw
+		if !block.Get("has_children").Bool() || !canHaveChildren(notion.BlockType(block.Get("type").String())) {
+			continue
+		}
+		children, err := n.fetchBlockTree(block.Get("id").String())
+		if err != nil {
+			return "", err
+		}
+		blocks[i], err = AttachChildBlocks(block.Raw, children)
+		if err != nil {
+			return "", err
+		}
+		nested = true
+	}
+	if !nested {
+		return content, nil
+	}
+	return ReplaceChildBlocks(content, blocks)
+}
+
 // fetchPageContent
 func (n *NotionOperator) fetchPageContent(uuid, startCursor string) (content string, err error) {
 	var url string
@@ -292,47 +649,198 @@ func (n *NotionOperator) fetchPageContent(uuid, startCursor string) (content str
 	return fullContent, nil
 }
 
-// ConvertImageBlock
-// 1. Down image
-// 2. Upload image content to 4everland buckets
-// 3. Replace url with the new image path
+// ConvertImageBlock re-hosting images uploaded to notion,
+// see rehostFile
 func (n *NotionOperator) ConvertImageBlock(blockDTO *notion.BlockDTO) notion.Block {
-	if blockDTO.Image.Type == notion.FileTypeFile {
-		objectKey := blockDTO.ID() + ".jpg"
-		newurl, err := n.uploadImageTo4Everland(blockDTO.Image.File.URL, objectKey)
+	n.rehostFile(&blockDTO.Image.Type, &blockDTO.Image.File, &blockDTO.Image.External)
+	return *blockDTO
+}
+
+// ConvertFileBlock re-hosting files, pdfs and videos uploaded to notion,
+// see rehostFile
+func (n *NotionOperator) ConvertFileBlock(blockDTO *notion.BlockDTO) notion.Block {
+	switch blockDTO.Type {
+	case notion.BlockTypeFile:
+		n.rehostFile(&blockDTO.File.Type, &blockDTO.File.File, &blockDTO.File.External)
+	case notion.BlockTypePDF:
+		n.rehostFile(&blockDTO.PDF.Type, &blockDTO.PDF.File, &blockDTO.PDF.External)
+	case notion.BlockTypeVideo:
+		n.rehostFile(&blockDTO.Video.Type, &blockDTO.Video.File, &blockDTO.Video.External)
+	}
+	return *blockDTO
+}
+
+// AssetStore the store images and files are re-hosted in
+func (n *NotionOperator) AssetStore() assets.AssetStore {
+	return n.assets
+}
+
+// rehostFile copying a file uploaded to notion to the asset store,
+// notion only accepts external files for new blocks.
+// The notion url is kept if the store is disabled or the upload fails,
+// it expires after an hour, still better than failing the upload.
+func (n *NotionOperator) rehostFile(fileType *notion.FileType, file **notion.FileFile, external **notion.FileExternal) {
+	if *fileType != notion.FileTypeFile || *file == nil {
+		return
+	}
+	srcUrl := (*file).URL
+	newurl := srcUrl
+	if n.assets.Name() != assets.BackendNone {
+		storedUrl, err := n.uploadAsset(srcUrl)
 		if err != nil {
-			log.Error("upload to 4everland error: ", err) // Just log the error
+			log.Errorf("upload to %s asset store error: %s", n.assets.Name(), err)
 		} else {
-			blockDTO.Image.File = nil
-			blockDTO.Image.Type = notion.FileTypeExternal
-			blockDTO.Image.External = &notion.FileExternal{
-				URL: newurl,
-			}
+			newurl = storedUrl
 		}
 	}
-	return *blockDTO
+	*fileType = notion.FileTypeExternal
+	*file = nil
+	*external = &notion.FileExternal{URL: newurl}
 }
 
-func (n *NotionOperator) uploadImageTo4Everland(imgPath, objectKey string) (url string, err error) {
-	log.Info("Download image: ", imgPath)
-	c := resty.New()
-	resp, err := c.R().Get(imgPath)
+// uploadAsset downloading the file and storing it under the hash of its content,
+// with the extension of its content type. Files stored already are not uploaded again,
+// files re-hosted by a previous run are not downloaded again, see hostedAsset.
+func (n *NotionOperator) uploadAsset(srcUrl string) (string, error) {
+	cacheKey := assetCacheKey(n.assets.Name(), srcUrl)
+	if hosted, ok := n.hostedAsset(cacheKey); ok {
+		log.WithField("key", hosted.Key).Debug("asset re-hosted already")
+		return hosted.URL, nil
+	}
+
+	log.Info("Download file: ", srcUrl)
+	file, err := downloadAsset(srcUrl)
 	if err != nil {
-		log.Error("get image error: ", err)
 		return "", err
 	}
-	// upload image to object store
-	input := &s3.PutObjectInput{
-		Bucket: aws.String(n.s3Bucket),
-		Key:    aws.String(objectKey),
-		Body:   bytes.NewReader(resp.Body()),
+	defer file.remove()
+
+	storedUrl, found, err := n.assets.Stat(context.TODO(), file.key)
+	if err != nil {
+		// like a 403 for a missing key without the list permission, uploaded anyway
+		log.WithField("key", file.key).Warn("stat asset error: ", err.Error())
+		found = false
+	}
+	if !found {
+		storedUrl, err = n.assets.Put(context.TODO(), file.key, file.contentType, file)
+		if err != nil {
+			return "", err
+		}
 	}
-	_, err = n.s3Client.PutObject(context.TODO(), input)
+	n.saveHostedAsset(cacheKey, hostedAsset{Key: file.key, URL: storedUrl})
+	return storedUrl, nil
+}
+
+// downloadedAsset a file downloaded to a temporary file, hashed on the way
+type downloadedAsset struct {
+	*os.File
+	// key object key of the content, see assets.ObjectKey
+	key         string
+	contentType string
+}
+
+func (f *downloadedAsset) remove() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// downloadAsset streaming a file into a temporary file, within <assets.download_timeout>
+// and <assets.max_file_size>, so that large videos and pdfs are never held in memory
+// @Return the file rewound, to be removed by the caller
+func downloadAsset(srcUrl string) (*downloadedAsset, error) {
+	timeout := 5 * time.Minute
+	if viper.IsSet("assets.download_timeout") {
+		timeout = viper.GetDuration("assets.download_timeout")
+	}
+	maxSize := int64(100 << 20)
+	if viper.IsSet("assets.max_file_size") {
+		maxSize = int64(viper.GetSizeInBytes("assets.max_file_size"))
+	}
+
+	resp, err := resty.New().SetTimeout(timeout).R().SetDoNotParseResponse(true).Get(srcUrl)
 	if err != nil {
-		log.Error("upload image error: ", err)
-		return "", err
+		return nil, fmt.Errorf("download file error: %w", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if resp.IsError() {
+		utils.LogResp_Error(resp)
+		return nil, fmt.Errorf("download file error: %s", resp.Status())
+	}
+	if resp.RawResponse.ContentLength > maxSize {
+		return nil, fmt.Errorf("download file error: %d bytes, max %d", resp.RawResponse.ContentLength, maxSize)
 	}
 
-	url = fmt.Sprintf("https://%s.4everland.store/%s", n.s3Bucket, objectKey)
-	return
+	tmp, err := os.CreateTemp("", "transbot-asset-*")
+	if err != nil {
+		return nil, fmt.Errorf("download file error: %w", err)
+	}
+	file := &downloadedAsset{File: tmp}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(body, maxSize+1))
+	if err == nil && size > maxSize {
+		err = fmt.Errorf("larger than %d bytes", maxSize)
+	}
+	if err != nil {
+		file.remove()
+		return nil, fmt.Errorf("download file error: %w", err)
+	}
+
+	head := make([]byte, assets.SniffLength)
+	read, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		file.remove()
+		return nil, fmt.Errorf("read downloaded file error: %w", err)
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		file.remove()
+		return nil, fmt.Errorf("read downloaded file error: %w", err)
+	}
+	file.contentType = assets.DetectContentType(head[:read], resp.Header().Get("Content-Type"), srcUrl)
+	file.key = assets.DigestKey(hash.Sum(nil), file.contentType)
+	return file, nil
+}
+
+// hostedAssetsBucket store bucket of the re-hosted files, see hostedAsset
+const hostedAssetsBucket = "hosted_assets"
+
+// hostedAsset a file uploaded to notion and re-hosted in the asset store
+type hostedAsset struct {
+	// Key object key in the asset store
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// assetCacheKey the asset store name and the url of the file without its query,
+// notion signs file urls with an expiring query, the path identifies the file
+func assetCacheKey(storeName, srcUrl string) string {
+	u, err := url.Parse(srcUrl)
+	if err != nil {
+		return storeName + "/" + srcUrl
+	}
+	return storeName + "/" + u.Host + u.Path
+}
+
+func (n *NotionOperator) hostedAsset(cacheKey string) (hostedAsset, bool) {
+	var hosted hostedAsset
+	if n.db == nil {
+		return hosted, false
+	}
+	found, err := n.db.Get(hostedAssetsBucket, cacheKey, &hosted)
+	if err != nil {
+		log.Warn("load hosted asset error: ", err.Error())
+		return hosted, false
+	}
+	return hosted, found
+}
+
+func (n *NotionOperator) saveHostedAsset(cacheKey string, hosted hostedAsset) {
+	if n.db == nil {
+		return
+	}
+	err := n.db.Put(hostedAssetsBucket, cacheKey, hosted)
+	if err != nil {
+		log.Warn("save hosted asset error: ", err.Error())
+	}
 }
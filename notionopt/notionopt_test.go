@@ -0,0 +1,115 @@
+package notionopt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/permadao/transbot/assets"
+	"github.com/permadao/transbot/store"
+	"github.com/spf13/viper"
+)
+
+// forbiddenStat an asset store answering every Stat with an error,
+// like S3 without the list permission
+type forbiddenStat struct {
+	assets.AssetStore
+}
+
+func (s forbiddenStat) Stat(ctx context.Context, key string) (string, bool, error) {
+	return "", false, errors.New("head object error: 403 Forbidden")
+}
+
+func TestUploadAsset(t *testing.T) {
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		w.Write([]byte("GIF89a image"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	local, err := assets.NewLocalStore(filepath.Join(dir, "uploads"), "http://localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.Open(filepath.Join(dir, "transbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	n := &NotionOperator{assets: forbiddenStat{local}, db: db}
+
+	url, err := n.uploadAsset(server.URL + "/workspace/file-id/image.gif?X-Amz-Signature=first")
+	if err != nil {
+		t.Fatalf("a failed stat should not fail the upload: %v", err)
+	}
+	key := assets.ObjectKey([]byte("GIF89a image"), "image/gif")
+	if want := "http://localhost:8080/assets/" + key; url != want {
+		t.Errorf("uploadAsset() = %s, want %s", url, want)
+	}
+
+	// the same file with a newly signed url is not downloaded again
+	again, err := n.uploadAsset(server.URL + "/workspace/file-id/image.gif?X-Amz-Signature=second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != url {
+		t.Errorf("uploadAsset() = %s, want the cached %s", again, url)
+	}
+	if got := atomic.LoadInt32(&downloads); got != 1 {
+		t.Errorf("downloaded %d times, want 1", got)
+	}
+}
+
+func TestDownloadAssetLimits(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 2048)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		case "/chunked":
+			// no content length, the size is only known while reading
+			w.Write(large[:1024])
+			w.(http.Flusher).Flush()
+			w.Write(large[1024:])
+			return
+		}
+		w.Write(large)
+	}))
+	defer server.Close()
+
+	viper.Set("assets.download_timeout", "100ms")
+	viper.Set("assets.max_file_size", "1kb")
+	defer func() {
+		viper.Set("assets.download_timeout", nil)
+		viper.Set("assets.max_file_size", nil)
+	}()
+	for _, path := range []string{"/slow", "/large", "/chunked"} {
+		if file, err := downloadAsset(server.URL + path); err == nil {
+			file.remove()
+			t.Errorf("downloadAsset(%s) succeeded, want an error", path)
+		}
+	}
+
+	viper.Set("assets.max_file_size", "4kb")
+	file, err := downloadAsset(server.URL + "/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.remove()
+	got, err := io.ReadAll(file)
+	if err != nil || !bytes.Equal(got, large) {
+		t.Errorf("downloaded %d bytes, %v", len(got), err)
+	}
+	if want := assets.ObjectKey(large, "text/plain"); file.key != want {
+		t.Errorf("key = %s, want %s", file.key, want)
+	}
+}
@@ -0,0 +1,527 @@
+package notionopt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+var (
+	// the date of a rendered SourceCallout
+	sourceCalloutDate = regexp.MustCompile(`(Machine translated from .*? with model \S+ on )\d{4}-\d{2}-\d{2}`)
+	// the date of a SourceCallout block, its runs are marshalled apart
+	calloutBlockDate = regexp.MustCompile(`( with model [^\s"]+ on )\d{4}-\d{2}-\d{2}`)
+	// the signed query of a notion file url, which expires after an hour
+	signedQuery = regexp.MustCompile(`(https?://[^\s"'<>()?]+)\?[^\s"'<>()]*X-Amz-[^\s"'<>()]*`)
+)
+
+// StableRendering the Markdown or HTML rendering of blocks without the parts
+// changing on every run: the date of the source callout and the signed query
+// of the urls of files kept on notion
+func StableRendering(text string) string {
+	text = sourceCalloutDate.ReplaceAllString(text, "${1}0000-00-00")
+	return signedQuery.ReplaceAllString(text, "$1")
+}
+
+// BlocksDigest digest of the content of the blocks and all their nested children,
+// without the parts changing on every run, like StableRendering.
+// Block ids and edit times are left out.
+func BlocksDigest(blocks []notion.Block) string {
+	h := sha256.New()
+	digestBlocks(h, blocks)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func digestBlocks(h hash.Hash, blocks []notion.Block) {
+	for _, block := range blocks {
+		content, _ := blockContent(block)
+		if blockType(block) == notion.BlockTypeCallout {
+			content = calloutBlockDate.ReplaceAllString(content, "${1}0000-00-00")
+		}
+		children := GetChildren(block)
+		// length prefixed, so that blocks can't run into each other
+		fmt.Fprintf(h, "%d:%s%d[", len(content), content, len(children))
+		digestBlocks(h, children)
+		h.Write([]byte("]"))
+	}
+}
+
+// RenderMarkdown rendering the blocks of a page as a markdown document,
+// colors and unsupported blocks are dropped
+func RenderMarkdown(title string, blocks []notion.Block) string {
+	var sb strings.Builder
+	if title != "" {
+		sb.WriteString("# " + escapeMarkdown(title) + "\n\n")
+	}
+	renderMarkdownBlocks(&sb, blocks, "")
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+// RenderHTML rendering the blocks of a page as a standalone html document
+// @Pararm lang, language code of the html element, may be empty
+func RenderHTML(title, lang string, blocks []notion.Block) string {
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html")
+	if lang != "" {
+		sb.WriteString(` lang="` + html.EscapeString(lang) + `"`)
+	}
+	sb.WriteString(">\n<head>\n<meta charset=\"utf-8\">\n")
+	sb.WriteString("<title>" + html.EscapeString(title) + "</title>\n</head>\n<body>\n<article>\n")
+	if title != "" {
+		sb.WriteString("<h1>" + html.EscapeString(title) + "</h1>\n")
+	}
+	renderHTMLBlocks(&sb, blocks)
+	sb.WriteString("</article>\n</body>\n</html>\n")
+	return sb.String()
+}
+
+func renderMarkdownBlocks(sb *strings.Builder, blocks []notion.Block, indent string) {
+	number := 0
+	inList := false
+	for _, block := range blocks {
+		dto, ok := block.(notion.BlockDTO)
+		if !ok {
+			continue
+		}
+		if dto.Type == notion.BlockTypeNumberedListItem {
+			number++
+		} else {
+			number = 0
+		}
+
+		// list items nest their children, other blocks are followed by them
+		children := GetChildren(block)
+		nested := indent + "  "
+		switch dto.Type {
+		case notion.BlockTypeBulletedListItem:
+			writeLines(sb, indent, "- "+markdownRichtext(dto.BulletedListItem.RichText))
+		case notion.BlockTypeNumberedListItem:
+			prefix := fmt.Sprintf("%d. ", number)
+			writeLines(sb, indent, prefix+markdownRichtext(dto.NumberedListItem.RichText))
+			nested = indent + strings.Repeat(" ", len(prefix))
+		case notion.BlockTypeToDo:
+			check := "[ ]"
+			if dto.ToDo.Checked != nil && *dto.ToDo.Checked {
+				check = "[x]"
+			}
+			writeLines(sb, indent, "- "+check+" "+markdownRichtext(dto.ToDo.RichText))
+		case notion.BlockTypeToggle:
+			writeLines(sb, indent, "- "+markdownRichtext(dto.Toggle.RichText))
+		default:
+			if inList {
+				sb.WriteString("\n")
+				inList = false
+			}
+			renderMarkdownBlock(sb, dto, indent)
+			if dto.Type != notion.BlockTypeTable && dto.Type != notion.BlockTypeColumnList {
+				// tables and column lists are rendered with their rows and columns
+				renderMarkdownBlocks(sb, children, indent)
+			}
+			continue
+		}
+		inList = true
+		renderMarkdownBlocks(sb, children, nested)
+	}
+	if inList && indent == "" {
+		// nested lists stay tight
+		sb.WriteString("\n")
+	}
+}
+
+// renderMarkdownBlock rendering a block other than a list item, followed by a blank line
+func renderMarkdownBlock(sb *strings.Builder, dto notion.BlockDTO, indent string) {
+	switch dto.Type {
+	case notion.BlockTypeParagraph:
+		writeLines(sb, indent, markdownRichtext(dto.Paragraph.RichText))
+	case notion.BlockTypeHeading1:
+		writeLines(sb, indent, "## "+markdownRichtext(dto.Heading1.RichText))
+	case notion.BlockTypeHeading2:
+		writeLines(sb, indent, "### "+markdownRichtext(dto.Heading2.RichText))
+	case notion.BlockTypeHeading3:
+		writeLines(sb, indent, "#### "+markdownRichtext(dto.Heading3.RichText))
+	case notion.BlockTypeQuote:
+		writeLines(sb, indent+"> ", markdownRichtext(dto.Quote.RichText))
+	case notion.BlockTypeCallout:
+		text := markdownRichtext(dto.Callout.RichText)
+		if dto.Callout.Icon != nil && dto.Callout.Icon.Emoji != nil {
+			text = *dto.Callout.Icon.Emoji + " " + text
+		}
+		writeLines(sb, indent+"> ", text)
+	case notion.BlockTypeCode:
+		language := ""
+		if dto.Code.Language != nil && *dto.Code.Language != "plain text" {
+			language = *dto.Code.Language
+		}
+		writeLines(sb, indent, "```"+language+"\n"+GetFullRichtext(dto.Code.RichText)+"\n```")
+	case notion.BlockTypeEquation:
+		writeLines(sb, indent, "$$\n"+dto.Equation.Expression+"\n$$")
+	case notion.BlockTypeDivider:
+		writeLines(sb, indent, "---")
+	case notion.BlockTypeImage:
+		writeLines(sb, indent, fmt.Sprintf("![%s](%s)", markdownRichtext(dto.Image.Caption),
+			markdownURL(fileURL(dto.Image.Type, dto.Image.File, dto.Image.External))))
+	case notion.BlockTypeVideo:
+		writeLines(sb, indent, markdownLink(dto.Video.Caption, fileURL(dto.Video.Type, dto.Video.File, dto.Video.External)))
+	case notion.BlockTypeFile:
+		writeLines(sb, indent, markdownLink(dto.File.Caption, fileURL(dto.File.Type, dto.File.File, dto.File.External)))
+	case notion.BlockTypePDF:
+		writeLines(sb, indent, markdownLink(dto.PDF.Caption, fileURL(dto.PDF.Type, dto.PDF.File, dto.PDF.External)))
+	case notion.BlockTypeBookmark:
+		writeLines(sb, indent, markdownLink(dto.Bookmark.Caption, dto.Bookmark.URL))
+	case notion.BlockTypeEmbed:
+		writeLines(sb, indent, markdownLink(nil, dto.Embed.URL))
+	case notion.BlockTypeTable:
+		writeLines(sb, indent, markdownTable(dto.Table))
+	case notion.BlockTypeColumnList:
+		for _, column := range dto.ColumnList.Children {
+			renderMarkdownBlocks(sb, column.Children, indent)
+		}
+		return
+	default:
+		return
+	}
+	sb.WriteString("\n")
+}
+
+func markdownTable(table *notion.TableBlock) string {
+	var lines []string
+	for i, row := range table.Children {
+		dto, ok := row.(notion.BlockDTO)
+		if !ok || dto.TableRow == nil {
+			continue
+		}
+		cells := make([]string, len(dto.TableRow.Cells))
+		for j, cell := range dto.TableRow.Cells {
+			// a row is a single line
+			cells[j] = strings.ReplaceAll(markdownRichtext(cell), "|", `\|`)
+			cells[j] = strings.ReplaceAll(cells[j], "\n", "<br>")
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			// markdown tables always have a header row
+			lines = append(lines, "|"+strings.Repeat(" --- |", len(cells)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func markdownLink(caption []notion.RichText, url string) string {
+	text := markdownRichtext(caption)
+	if text == "" {
+		text = escapeMarkdown(url)
+	}
+	return fmt.Sprintf("[%s](%s)", text, markdownURL(url))
+}
+
+// markdownRichtext rendering bold, italic, strikethrough, code and links,
+// markers are kept inside the surrounding spaces of a run
+func markdownRichtext(richText []notion.RichText) string {
+	var sb strings.Builder
+	for _, rt := range richText {
+		if rt.Type == notion.RichTextTypeEquation && rt.Equation != nil {
+			sb.WriteString("$" + rt.Equation.Expression + "$")
+			continue
+		}
+		// styles are applied line by line, markdown emphasis can't span lines
+		lines := strings.Split(richtextContent(rt), "\n")
+		for i, line := range lines {
+			lines[i] = markdownRun(rt, line)
+		}
+		sb.WriteString(strings.Join(lines, "\n"))
+	}
+	return sb.String()
+}
+
+// markdownRun a line of a rich text run, styled and linked,
+// the surrounding whitespace is kept out of the markers
+func markdownRun(rt notion.RichText, text string) string {
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+	lead := text[:len(text)-len(strings.TrimLeftFunc(text, unicode.IsSpace))]
+	trail := text[len(strings.TrimRightFunc(text, unicode.IsSpace)):]
+	text = strings.TrimSpace(text)
+
+	if a := rt.Annotations; a != nil && a.Code {
+		if strings.Contains(text, "`") {
+			text = "`` " + text + " ``"
+		} else {
+			text = "`" + text + "`"
+		}
+	} else {
+		text = escapeMarkdown(text)
+	}
+	if a := rt.Annotations; a != nil {
+		if a.Bold {
+			text = "**" + text + "**"
+		}
+		if a.Italic {
+			text = "_" + text + "_"
+		}
+		if a.Strikethrough {
+			text = "~~" + text + "~~"
+		}
+	}
+	if href := richtextHref(rt); href != "" {
+		text = fmt.Sprintf("[%s](%s)", text, markdownURL(href))
+	}
+	return lead + text + trail
+}
+
+// markdownURLEscaper escaping the characters ending a markdown link destination
+var markdownURLEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E")
+
+func markdownURL(url string) string {
+	return markdownURLEscaper.Replace(url)
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+)
+
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// writeLines writing text with every line prefixed
+func writeLines(sb *strings.Builder, prefix, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		sb.WriteString(prefix + line + "\n")
+	}
+}
+
+func renderHTMLBlocks(sb *strings.Builder, blocks []notion.Block) {
+	var list string
+	for _, block := range blocks {
+		dto, ok := block.(notion.BlockDTO)
+		if !ok {
+			continue
+		}
+
+		// consecutive list items share a list element
+		tag := ""
+		switch dto.Type {
+		case notion.BlockTypeBulletedListItem, notion.BlockTypeToDo:
+			tag = "ul"
+		case notion.BlockTypeNumberedListItem:
+			tag = "ol"
+		}
+		if list != tag {
+			if list != "" {
+				sb.WriteString("</" + list + ">\n")
+			}
+			if tag != "" {
+				sb.WriteString("<" + tag + ">\n")
+			}
+			list = tag
+		}
+		renderHTMLBlock(sb, dto)
+	}
+	if list != "" {
+		sb.WriteString("</" + list + ">\n")
+	}
+}
+
+func renderHTMLBlock(sb *strings.Builder, dto notion.BlockDTO) {
+	children := GetChildren(dto)
+	switch dto.Type {
+	case notion.BlockTypeParagraph:
+		sb.WriteString("<p>" + htmlRichtext(dto.Paragraph.RichText) + "</p>\n")
+	case notion.BlockTypeHeading1:
+		sb.WriteString("<h2>" + htmlRichtext(dto.Heading1.RichText) + "</h2>\n")
+	case notion.BlockTypeHeading2:
+		sb.WriteString("<h3>" + htmlRichtext(dto.Heading2.RichText) + "</h3>\n")
+	case notion.BlockTypeHeading3:
+		sb.WriteString("<h4>" + htmlRichtext(dto.Heading3.RichText) + "</h4>\n")
+	case notion.BlockTypeBulletedListItem:
+		writeHTMLItem(sb, htmlRichtext(dto.BulletedListItem.RichText), children)
+		return
+	case notion.BlockTypeNumberedListItem:
+		writeHTMLItem(sb, htmlRichtext(dto.NumberedListItem.RichText), children)
+		return
+	case notion.BlockTypeToDo:
+		checked := ""
+		if dto.ToDo.Checked != nil && *dto.ToDo.Checked {
+			checked = " checked"
+		}
+		writeHTMLItem(sb, `<input type="checkbox" disabled`+checked+`> `+htmlRichtext(dto.ToDo.RichText), children)
+		return
+	case notion.BlockTypeToggle:
+		sb.WriteString("<details>\n<summary>" + htmlRichtext(dto.Toggle.RichText) + "</summary>\n")
+		renderHTMLBlocks(sb, children)
+		sb.WriteString("</details>\n")
+		return
+	case notion.BlockTypeQuote:
+		sb.WriteString("<blockquote>" + htmlRichtext(dto.Quote.RichText) + "\n")
+		renderHTMLBlocks(sb, children)
+		sb.WriteString("</blockquote>\n")
+		return
+	case notion.BlockTypeCallout:
+		sb.WriteString(`<aside class="callout">`)
+		if dto.Callout.Icon != nil && dto.Callout.Icon.Emoji != nil {
+			sb.WriteString(html.EscapeString(*dto.Callout.Icon.Emoji) + " ")
+		}
+		sb.WriteString(htmlRichtext(dto.Callout.RichText) + "\n")
+		renderHTMLBlocks(sb, children)
+		sb.WriteString("</aside>\n")
+		return
+	case notion.BlockTypeCode:
+		class := ""
+		if dto.Code.Language != nil {
+			class = ` class="language-` + html.EscapeString(*dto.Code.Language) + `"`
+		}
+		sb.WriteString("<pre><code" + class + ">" + html.EscapeString(GetFullRichtext(dto.Code.RichText)) + "</code></pre>\n")
+	case notion.BlockTypeEquation:
+		sb.WriteString(`<div class="equation">` + html.EscapeString(dto.Equation.Expression) + "</div>\n")
+	case notion.BlockTypeDivider:
+		sb.WriteString("<hr>\n")
+	case notion.BlockTypeImage:
+		caption := htmlRichtext(dto.Image.Caption)
+		sb.WriteString(fmt.Sprintf(`<figure><img src="%s" alt="%s">`,
+			html.EscapeString(fileURL(dto.Image.Type, dto.Image.File, dto.Image.External)),
+			html.EscapeString(GetFullRichtext(dto.Image.Caption))))
+		if caption != "" {
+			sb.WriteString("<figcaption>" + caption + "</figcaption>")
+		}
+		sb.WriteString("</figure>\n")
+	case notion.BlockTypeVideo:
+		sb.WriteString(fmt.Sprintf(`<video controls src="%s"></video>`+"\n",
+			html.EscapeString(fileURL(dto.Video.Type, dto.Video.File, dto.Video.External))))
+	case notion.BlockTypeFile:
+		sb.WriteString("<p>" + htmlLink(dto.File.Caption, fileURL(dto.File.Type, dto.File.File, dto.File.External)) + "</p>\n")
+	case notion.BlockTypePDF:
+		sb.WriteString("<p>" + htmlLink(dto.PDF.Caption, fileURL(dto.PDF.Type, dto.PDF.File, dto.PDF.External)) + "</p>\n")
+	case notion.BlockTypeBookmark:
+		sb.WriteString("<p>" + htmlLink(dto.Bookmark.Caption, dto.Bookmark.URL) + "</p>\n")
+	case notion.BlockTypeEmbed:
+		sb.WriteString("<p>" + htmlLink(nil, dto.Embed.URL) + "</p>\n")
+	case notion.BlockTypeTable:
+		writeHTMLTable(sb, dto.Table)
+		return
+	case notion.BlockTypeColumnList:
+		sb.WriteString(`<div class="columns">` + "\n")
+		for _, column := range dto.ColumnList.Children {
+			sb.WriteString(`<div class="column">` + "\n")
+			renderHTMLBlocks(sb, column.Children)
+			sb.WriteString("</div>\n")
+		}
+		sb.WriteString("</div>\n")
+		return
+	default:
+		return
+	}
+	renderHTMLBlocks(sb, children)
+}
+
+func writeHTMLItem(sb *strings.Builder, content string, children []notion.Block) {
+	sb.WriteString("<li>" + content)
+	if len(children) > 0 {
+		sb.WriteString("\n")
+		renderHTMLBlocks(sb, children)
+	}
+	sb.WriteString("</li>\n")
+}
+
+func writeHTMLTable(sb *strings.Builder, table *notion.TableBlock) {
+	sb.WriteString("<table>\n")
+	for i, row := range table.Children {
+		dto, ok := row.(notion.BlockDTO)
+		if !ok || dto.TableRow == nil {
+			continue
+		}
+		sb.WriteString("<tr>")
+		for j, cell := range dto.TableRow.Cells {
+			tag := "td"
+			if (i == 0 && table.HasColumnHeader) || (j == 0 && table.HasRowHeader) {
+				tag = "th"
+			}
+			sb.WriteString("<" + tag + ">" + htmlRichtext(cell) + "</" + tag + ">")
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</table>\n")
+}
+
+func htmlLink(caption []notion.RichText, url string) string {
+	text := htmlRichtext(caption)
+	if text == "" {
+		text = html.EscapeString(url)
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), text)
+}
+
+// htmlRichtext rendering bold, italic, strikethrough, underline, code and links
+func htmlRichtext(richText []notion.RichText) string {
+	var sb strings.Builder
+	for _, rt := range richText {
+		text := html.EscapeString(richtextContent(rt))
+		if rt.Type == notion.RichTextTypeEquation && rt.Equation != nil {
+			text = `<span class="equation">` + html.EscapeString(rt.Equation.Expression) + "</span>"
+		}
+		text = strings.ReplaceAll(text, "\n", "<br>")
+		if a := rt.Annotations; a != nil {
+			if a.Code {
+				text = "<code>" + text + "</code>"
+			}
+			if a.Bold {
+				text = "<strong>" + text + "</strong>"
+			}
+			if a.Italic {
+				text = "<em>" + text + "</em>"
+			}
+			if a.Strikethrough {
+				text = "<s>" + text + "</s>"
+			}
+			if a.Underline {
+				text = "<u>" + text + "</u>"
+			}
+		}
+		if href := richtextHref(rt); href != "" {
+			text = `<a href="` + html.EscapeString(href) + `">` + text + "</a>"
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// richtextContent the text of a run, mentions without text show their link
+func richtextContent(rt notion.RichText) string {
+	if rt.Text != nil {
+		return rt.Text.Content
+	}
+	if rt.PlainText == "" {
+		return richtextHref(rt)
+	}
+	return rt.PlainText
+}
+
+// richtextHref the link of a run, page mentions link to notion
+func richtextHref(rt notion.RichText) string {
+	if rt.Text != nil && rt.Text.Link != nil {
+		return rt.Text.Link.URL
+	}
+	if rt.HRef != nil {
+		return *rt.HRef
+	}
+	if rt.Mention != nil && rt.Mention.Page != nil {
+		return "https://www.notion.so/" + NormalizeID(rt.Mention.Page.ID)
+	}
+	return ""
+}
+
+func fileURL(fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal) string {
+	if fileType == notion.FileTypeExternal && external != nil {
+		return external.URL
+	}
+	if file != nil {
+		return file.URL
+	}
+	return ""
+}
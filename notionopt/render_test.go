@@ -0,0 +1,263 @@
+package notionopt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+func linkRich(content, url string, annotations *notion.Annotations) notion.RichText {
+	rt := textRich(content, annotations)
+	rt.Text.Link = &notion.Link{URL: url}
+	return rt
+}
+
+func paragraph(richText ...notion.RichText) notion.Block {
+	return notion.BlockDTO{Type: notion.BlockTypeParagraph, Paragraph: &notion.ParagraphBlock{RichText: richText}}
+}
+
+func bulleted(text string, children ...notion.Block) notion.Block {
+	return notion.BlockDTO{Type: notion.BlockTypeBulletedListItem, BulletedListItem: &notion.BulletedListItemBlock{
+		RichText: []notion.RichText{textRich(text, nil)}, Children: children,
+	}}
+}
+
+func numbered(text string, children ...notion.Block) notion.Block {
+	return notion.BlockDTO{Type: notion.BlockTypeNumberedListItem, NumberedListItem: &notion.NumberedListItemBlock{
+		RichText: []notion.RichText{textRich(text, nil)}, Children: children,
+	}}
+}
+
+func toDo(text string, checked bool) notion.Block {
+	return notion.BlockDTO{Type: notion.BlockTypeToDo, ToDo: &notion.ToDoBlock{
+		RichText: []notion.RichText{textRich(text, nil)}, Checked: &checked,
+	}}
+}
+
+func table(header bool, rows ...[]string) notion.Block {
+	children := make([]notion.Block, len(rows))
+	for i, row := range rows {
+		cells := make([][]notion.RichText, len(row))
+		for j, cell := range row {
+			cells[j] = []notion.RichText{textRich(cell, nil)}
+		}
+		children[i] = notion.BlockDTO{Type: notion.BlockTypeTableRow, TableRow: &notion.TableRowBlock{Cells: cells}}
+	}
+	return notion.BlockDTO{Type: notion.BlockTypeTable, Table: &notion.TableBlock{
+		TableWidth: len(rows[0]), HasColumnHeader: header, Children: children,
+	}}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	tests := []struct {
+		name   string
+		blocks []notion.Block
+		want   string
+	}{
+		{
+			"annotations",
+			[]notion.Block{paragraph(
+				textRich("plain ", nil),
+				textRich("bold ", bold),
+				textRich("italic", &notion.Annotations{Italic: true}),
+				textRich(" ", nil),
+				textRich("a`b", &notion.Annotations{Code: true}),
+				textRich(" ", nil),
+				textRich("gone", &notion.Annotations{Strikethrough: true}),
+			)},
+			"plain **bold** _italic_ `` a`b `` ~~gone~~\n",
+		},
+		{
+			"styled run ending a line",
+			[]notion.Block{paragraph(textRich("first line\n", bold), textRich("second", nil))},
+			"**first line**\nsecond\n",
+		},
+		{
+			"styled run across lines",
+			[]notion.Block{paragraph(textRich("one\n\ttwo", &notion.Annotations{Italic: true}))},
+			"_one_\n\t_two_\n",
+		},
+		{
+			"escaping",
+			[]notion.Block{paragraph(textRich(`a*b_c [d] <e> \f`, nil))},
+			`a\*b\_c \[d\] \<e\> \\f` + "\n",
+		},
+		{
+			"links",
+			[]notion.Block{paragraph(
+				linkRich("wiki", "https://en.wikipedia.org/wiki/Go_(game)", nil),
+				textRich(" ", nil),
+				linkRich("doc", "https://example.com/a file.pdf", bold),
+			)},
+			"[wiki](https://en.wikipedia.org/wiki/Go_%28game%29) [**doc**](https://example.com/a%20file.pdf)\n",
+		},
+		{
+			"lists",
+			[]notion.Block{
+				bulleted("one", bulleted("nested")),
+				bulleted("two"),
+				numbered("first", numbered("inner")),
+				numbered("second"),
+				toDo("done", true),
+				toDo("open", false),
+				paragraph(textRich("after", nil)),
+			},
+			"- one\n  - nested\n- two\n1. first\n   1. inner\n2. second\n- [x] done\n- [ ] open\n\nafter\n",
+		},
+		{
+			"table",
+			[]notion.Block{table(true, []string{"name", "a|b"}, []string{"x\ny", "z"})},
+			"| name | a\\|b |\n| --- | --- |\n| x<br>y | z |\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderMarkdown("", tt.blocks); got != tt.want {
+				t.Errorf("RenderMarkdown() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownTitle(t *testing.T) {
+	got := RenderMarkdown("A *title*", []notion.Block{paragraph(textRich("text", nil))})
+	if want := "# A \\*title\\*\n\ntext\n"; got != want {
+		t.Errorf("RenderMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	tests := []struct {
+		name   string
+		blocks []notion.Block
+		want   string
+	}{
+		{
+			"annotations",
+			[]notion.Block{paragraph(
+				textRich("bold", bold),
+				textRich(" <tag> & ", nil),
+				textRich("code", &notion.Annotations{Code: true}),
+				textRich("line\nbreak", &notion.Annotations{Underline: true}),
+			)},
+			"<p><strong>bold</strong> &lt;tag&gt; &amp; <code>code</code><u>line<br>break</u></p>\n",
+		},
+		{
+			"links",
+			[]notion.Block{paragraph(linkRich("search", `https://example.com/?q="a"&b=1`, nil))},
+			`<p><a href="https://example.com/?q=&#34;a&#34;&amp;b=1">search</a></p>` + "\n",
+		},
+		{
+			"lists",
+			[]notion.Block{
+				bulleted("one", bulleted("nested")),
+				bulleted("two"),
+				numbered("first"),
+				toDo("done", true),
+			},
+			"<ul>\n<li>one\n<ul>\n<li>nested</li>\n</ul>\n</li>\n<li>two</li>\n</ul>\n" +
+				"<ol>\n<li>first</li>\n</ol>\n" +
+				"<ul>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n",
+		},
+		{
+			"table",
+			[]notion.Block{table(true, []string{"name", "value"}, []string{"a<b", "1"})},
+			"<table>\n<tr><th>name</th><th>value</th></tr>\n<tr><td>a&lt;b</td><td>1</td></tr>\n</table>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderHTML("", "", tt.blocks)
+			body := between(got, "<article>\n", "</article>")
+			if body != tt.want {
+				t.Errorf("RenderHTML() body =\n%q\nwant\n%q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLDocument(t *testing.T) {
+	got := RenderHTML("Tom & Jerry", "zh", nil)
+	for _, want := range []string{`<html lang="zh">`, "<title>Tom &amp; Jerry</title>", "<h1>Tom &amp; Jerry</h1>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("RenderHTML() misses %q:\n%s", want, got)
+		}
+	}
+}
+
+func between(text, start, end string) string {
+	i := strings.Index(text, start)
+	j := strings.LastIndex(text, end)
+	if i < 0 || j < i {
+		return ""
+	}
+	return text[i+len(start) : j]
+}
+
+func TestStableRendering(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			"callout date",
+			"> 🌐 Machine translated from [Source](https://www.notion.so/abc) with model gpt-4o on 2024-03-04.",
+			"> 🌐 Machine translated from [Source](https://www.notion.so/abc) with model gpt-4o on 0000-00-00.",
+		},
+		{
+			"signed url",
+			`<img src="https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/a.png?X-Amz-Algorithm=AWS4-HMAC-SHA256&amp;X-Amz-Signature=abc">`,
+			`<img src="https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/a.png">`,
+		},
+		{
+			"markdown signed url",
+			"![cat](https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/a.png?X-Amz-Signature=abc)",
+			"![cat](https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/a.png)",
+		},
+		{"other query", "![cat](https://example.com/a.png?w=200)", "![cat](https://example.com/a.png?w=200)"},
+		{"other date", "Released on 2024-03-04.", "Released on 2024-03-04."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StableRendering(tt.text); got != tt.want {
+				t.Errorf("StableRendering() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlocksDigest(t *testing.T) {
+	signed := func(signature string) string {
+		return "https://prod-files-secure.s3.us-west-2.amazonaws.com/ws/file/a.png?X-Amz-Signature=" + signature
+	}
+	callout := func(date time.Time) notion.Block {
+		return SourceCallout("source-id", "gpt-4o", date)
+	}
+	first := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	second := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		a, b  []notion.Block
+		equal bool
+	}{
+		{"callout date", []notion.Block{callout(first)}, []notion.Block{callout(second)}, true},
+		{"callout model", []notion.Block{callout(first)}, []notion.Block{SourceCallout("source-id", "deepl", first)}, false},
+		{"signed url", []notion.Block{image(signed("1"), true, "")}, []notion.Block{image(signed("2"), true, "")}, true},
+		{"block ids", []notion.Block{withID(paragraph(textRich("a", nil)), "1")}, []notion.Block{withID(paragraph(textRich("a", nil)), "2")}, true},
+		{"table cell", []notion.Block{table(false, []string{"a", "b"})}, []notion.Block{table(false, []string{"a", "c"})}, false},
+		{"nested child", []notion.Block{bulleted("a", bulleted("b"))}, []notion.Block{bulleted("a", bulleted("c"))}, false},
+		{"moved into a child", []notion.Block{bulleted("a"), bulleted("b")}, []notion.Block{bulleted("a", bulleted("b"))}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlocksDigest(tt.a) == BlocksDigest(tt.b); got != tt.equal {
+				t.Errorf("equal digests = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
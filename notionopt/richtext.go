@@ -0,0 +1,307 @@
+package notionopt
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cryptowizard0/go-notion"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rich text markup
+// Styled runs are wrapped in <sN>...</sN>, mentions and equations become
+// placeholders <mN/>, where N is the index of the original run.
+// Plain runs are written as is. '&', '<' and '>' in the text are escaped.
+var (
+	markupEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	markupTagReg  = regexp.MustCompile(`</?s\d+>|<m\d+/>`)
+)
+
+// NeedsMarkup reports whether the rich text carries formatting
+// that would be lost by flattening it into a single string.
+func NeedsMarkup(richText []notion.RichText) bool {
+	for i := range richText {
+		if !isPlainRun(&richText[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeRichtext serialising rich text runs into the tagged markup.
+// Returns the escaped plain text if no run carries formatting.
+func EncodeRichtext(richText []notion.RichText) string {
+	if !NeedsMarkup(richText) {
+		return markupEscaper.Replace(GetFullRichtext(richText))
+	}
+
+	var sb strings.Builder
+	for i := range richText {
+		rt := &richText[i]
+		switch {
+		case rt.Text == nil:
+			fmt.Fprintf(&sb, "<m%d/>", i)
+		case isPlainRun(rt):
+			sb.WriteString(markupEscaper.Replace(rt.Text.Content))
+		default:
+			fmt.Fprintf(&sb, "<s%d>%s</s%d>", i, markupEscaper.Replace(rt.Text.Content), i)
+		}
+	}
+	return sb.String()
+}
+
+// DecodeRichtext mapping translated markup back onto rich text runs.
+// Styled runs keep the annotations and links of the original run they refer to,
+// placeholders are replaced by the original mention or equation.
+func DecodeRichtext(original []notion.RichText, markup string) ([]notion.RichText, error) {
+	var result []notion.RichText
+	appendText := func(content string, src *notion.RichText) {
+		content = html.UnescapeString(content)
+		if content == "" {
+			return
+		}
+		rt := notion.RichText{
+			Type: notion.RichTextTypeText,
+			Text: &notion.Text{Content: content},
+		}
+		if src != nil {
+			rt.Annotations = src.Annotations
+			rt.HRef = src.HRef
+			rt.Text.Link = src.Text.Link
+		}
+		result = append(result, rt)
+	}
+
+	rest := markup
+	for rest != "" {
+		start := strings.IndexByte(rest, '<')
+		if start < 0 {
+			appendText(rest, nil)
+			break
+		}
+		appendText(rest[:start], nil)
+		rest = rest[start:]
+
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return nil, fmt.Errorf("decode rich text: unclosed tag")
+		}
+		tag := rest[1:end]
+		rest = rest[end+1:]
+
+		switch {
+		case strings.HasPrefix(tag, "m") && strings.HasSuffix(tag, "/"):
+			index, err := markupIndex(original, tag[1:len(tag)-1])
+			if err != nil {
+				return nil, err
+			}
+			if original[index].Text != nil {
+				return nil, fmt.Errorf("decode rich text: <m%d/> is not a placeholder", index)
+			}
+			result = append(result, original[index])
+		case strings.HasPrefix(tag, "s"):
+			index, err := markupIndex(original, tag[1:])
+			if err != nil {
+				return nil, err
+			}
+			if original[index].Text == nil {
+				return nil, fmt.Errorf("decode rich text: <s%d> is not a text run", index)
+			}
+			closing := fmt.Sprintf("</s%d>", index)
+			end := strings.Index(rest, closing)
+			if end < 0 {
+				return nil, fmt.Errorf("decode rich text: missing %s", closing)
+			}
+			if strings.ContainsRune(rest[:end], '<') {
+				return nil, fmt.Errorf("decode rich text: nested tag in <s%d>", index)
+			}
+			appendText(rest[:end], &original[index])
+			rest = rest[end+len(closing):]
+		default:
+			return nil, fmt.Errorf("decode rich text: unknown tag <%s>", tag)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, ErrRichtextIsNull
+	}
+	return result, nil
+}
+
+// StripMarkup removing all markup tags, returns the plain text
+func StripMarkup(markup string) string {
+	return html.UnescapeString(markupTagReg.ReplaceAllString(markup, ""))
+}
+
+// TranslateRichtext translating rich text while keeping the formatting of every run.
+// Falls back to flattening the text into the first run when the translated markup
+// can not be parsed.
+func TranslateRichtext(richtext *[]notion.RichText, translate TranslateFunc) error {
+	if len(*richtext) == 0 {
+		return ErrRichtextIsNull
+	}
+
+	traned, err := translate(EncodeRichtext(*richtext))
+	if err != nil {
+		return err
+	}
+	return ApplyTranslation(richtext, traned)
+}
+
+// ApplyTranslation replacing rich text by its translated markup, see EncodeRichtext.
+// Falls back to flattening the text into the first run when the markup
+// can not be parsed. Runs over the notion length limit are split.
+func ApplyTranslation(richtext *[]notion.RichText, traned string) error {
+	if !NeedsMarkup(*richtext) {
+		return ReplaceRichtext(richtext, html.UnescapeString(traned))
+	}
+
+	decoded, err := DecodeRichtext(*richtext, traned)
+	if err != nil {
+		log.Warn("decode translated rich text failed, fallback to plain text: ", err)
+		return ReplaceRichtext(richtext, StripMarkup(traned))
+	}
+	*richtext = SplitRichtext(decoded)
+	return nil
+}
+
+// Segment a translatable rich text of a block
+type Segment struct {
+	Block notion.Block
+	// BlockIndex position of the block in document order,
+	// segments of the same block share it
+	BlockIndex int
+	RichText   *[]notion.RichText
+	// comment is set for a comment of a code block, RichText is the whole code then
+	comment *codeComment
+}
+
+// Source returns the markup to be translated, see EncodeRichtext
+func (s Segment) Source() string {
+	if s.comment != nil {
+		return markupEscaper.Replace(s.comment.text())
+	}
+	return EncodeRichtext(*s.RichText)
+}
+
+// Text returns the plain text of the segment
+func (s Segment) Text() string {
+	if s.comment != nil {
+		return s.comment.text()
+	}
+	return GetFullRichtext(*s.RichText)
+}
+
+// Apply replacing the rich text by its translated markup
+func (s Segment) Apply(traned string) error {
+	if s.comment != nil {
+		return s.comment.apply(s.RichText, html.UnescapeString(traned))
+	}
+	return ApplyTranslation(s.RichText, traned)
+}
+
+// Chunks returns the source split into chunks of about limit UTF-16 code units,
+// a limit <= 0 disables chunking
+func (s Segment) Chunks(limit int) []string {
+	return ChunkMarkup(s.Source(), limit)
+}
+
+// ApplyChunks replacing the rich text by the translated chunks, see Chunks
+func (s Segment) ApplyChunks(sources, traned []string) error {
+	return s.Apply(JoinChunks(sources, traned))
+}
+
+// CollectSegments collecting the translatable rich text of blocks
+// and all their nested children, in document order.
+// Table cells are segments of their row.
+// @Pararm codeComments, collect the comments of code blocks, the code is never translated
+func CollectSegments(blocks []notion.Block, codeComments bool) []Segment {
+	index := 0
+	return collectSegments(blocks, &index, codeComments)
+}
+
+func collectSegments(blocks []notion.Block, index *int, codeComments bool) []Segment {
+	var segments []Segment
+	for _, block := range blocks {
+		segments = append(segments, blockSegments(block, *index, codeComments)...)
+		*index++
+		segments = append(segments, collectSegments(GetChildren(block), index, codeComments)...)
+	}
+	return segments
+}
+
+func blockSegments(block notion.Block, index int, codeComments bool) []Segment {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return nil
+	}
+
+	switch dto.Type {
+	case notion.BlockTypeTableRow:
+		var segments []Segment
+		for i := range dto.TableRow.Cells {
+			if hasText(dto.TableRow.Cells[i]) {
+				segments = append(segments, Segment{Block: block, BlockIndex: index, RichText: &dto.TableRow.Cells[i]})
+			}
+		}
+		return segments
+	case notion.BlockTypeCode:
+		if !codeComments {
+			return nil
+		}
+		return codeSegments(block, dto.Code, index)
+	}
+
+	richtext, _ := GetRichtext(block)
+	if richtext == nil || !hasText(*richtext) {
+		return nil
+	}
+	return []Segment{{Block: block, BlockIndex: index, RichText: richtext}}
+}
+
+// TranslateBlockContent translating block content, keeping the formatting.
+// Blocks without text content are left untouched.
+func TranslateBlockContent(block notion.Block, translate TranslateFunc) error {
+	richtext, err := GetRichtext(block)
+	if err != nil {
+		return err
+	}
+	if richtext == nil || !hasText(*richtext) {
+		return nil
+	}
+	return TranslateRichtext(richtext, translate)
+}
+
+// Mentions and equations only are not worth translating
+func hasText(richText []notion.RichText) bool {
+	for _, rt := range richText {
+		if rt.Text != nil && strings.TrimSpace(rt.Text.Content) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// A run is plain if it's text without annotations and links
+func isPlainRun(rt *notion.RichText) bool {
+	if rt.Text == nil || rt.HRef != nil || rt.Text.Link != nil {
+		return false
+	}
+	if rt.Annotations == nil {
+		return true
+	}
+	a := *rt.Annotations
+	return !a.Bold && !a.Italic && !a.Strikethrough && !a.Underline && !a.Code &&
+		(a.Color == "" || a.Color == notion.ColorDefault)
+}
+
+func markupIndex(original []notion.RichText, s string) (int, error) {
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 || index >= len(original) {
+		return 0, fmt.Errorf("decode rich text: invalid run index %q", s)
+	}
+	return index, nil
+}
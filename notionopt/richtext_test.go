@@ -0,0 +1,171 @@
+package notionopt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+func textRich(content string, annotations *notion.Annotations) notion.RichText {
+	return notion.RichText{
+		Type:        notion.RichTextTypeText,
+		Text:        &notion.Text{Content: content},
+		Annotations: annotations,
+		PlainText:   content,
+	}
+}
+
+func mentionRich(pageId string) notion.RichText {
+	return notion.RichText{
+		Type:      notion.RichTextTypeMention,
+		Mention:   &notion.Mention{Type: notion.MentionTypePage, Page: &notion.ID{ID: pageId}},
+		PlainText: "page",
+	}
+}
+
+func TestEncodeRichtext(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	tests := []struct {
+		name     string
+		richText []notion.RichText
+		want     string
+	}{
+		{"plain", []notion.RichText{textRich("a < b", nil), textRich(" & c", nil)}, "a &lt; b &amp; c"},
+		{"styled", []notion.RichText{textRich("Hello ", nil), textRich("world", bold)}, "Hello <s1>world</s1>"},
+		{"escaped", []notion.RichText{textRich("a<b>&", bold)}, "<s0>a&lt;b&gt;&amp;</s0>"},
+		{"mention", []notion.RichText{textRich("see ", nil), mentionRich("p1"), textRich(".", nil)}, "see <m1/>."},
+		{"emoji", []notion.RichText{textRich("👍🏽", bold), textRich("ok", nil)}, "<s0>👍🏽</s0>ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodeRichtext(tt.richText); got != tt.want {
+				t.Errorf("EncodeRichtext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRichtextRoundTrip(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	link := textRich("link", nil)
+	link.Text.Link = &notion.Link{URL: "https://example.com"}
+	tests := []struct {
+		name     string
+		richText []notion.RichText
+	}{
+		{"styled", []notion.RichText{textRich("Hello ", nil), textRich("world", bold), textRich("!", nil)}},
+		{"escaped", []notion.RichText{textRich("a<b>&", bold), textRich(" x > y", nil)}},
+		{"mention", []notion.RichText{textRich("see ", bold), mentionRich("p1"), textRich(" & more", nil)}},
+		{"link", []notion.RichText{link, textRich(" 👨‍👩‍👧 family", bold)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeRichtext(tt.richText, EncodeRichtext(tt.richText))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded) != len(tt.richText) {
+				t.Fatalf("decoded %d runs, want %d", len(decoded), len(tt.richText))
+			}
+			for i := range decoded {
+				want := tt.richText[i]
+				if want.Text == nil {
+					if !reflect.DeepEqual(decoded[i], want) {
+						t.Errorf("run %d = %+v, want the original placeholder", i, decoded[i])
+					}
+					continue
+				}
+				if decoded[i].Text.Content != want.Text.Content {
+					t.Errorf("run %d content = %q, want %q", i, decoded[i].Text.Content, want.Text.Content)
+				}
+				if !reflect.DeepEqual(decoded[i].Annotations, want.Annotations) {
+					t.Errorf("run %d annotations = %+v, want %+v", i, decoded[i].Annotations, want.Annotations)
+				}
+				if !reflect.DeepEqual(decoded[i].Text.Link, want.Text.Link) {
+					t.Errorf("run %d link = %+v, want %+v", i, decoded[i].Text.Link, want.Text.Link)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRichtextTranslated(t *testing.T) {
+	bold := &notion.Annotations{Bold: true}
+	original := []notion.RichText{textRich("Hello ", nil), textRich("world", bold), mentionRich("p1")}
+	decoded, err := DecodeRichtext(original, "<m2/> <s1>世界</s1>你好")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 4 {
+		t.Fatalf("decoded %d runs, want 4", len(decoded))
+	}
+	if decoded[0].Mention == nil || decoded[2].Text.Content != "世界" || decoded[2].Annotations != bold ||
+		decoded[3].Text.Content != "你好" || decoded[3].Annotations != nil {
+		t.Errorf("unexpected runs: %+v", decoded)
+	}
+}
+
+func TestDecodeRichtextInvalid(t *testing.T) {
+	original := []notion.RichText{textRich("a", &notion.Annotations{Bold: true}), mentionRich("p1")}
+	for _, markup := range []string{
+		"<s0>a",           // missing closing tag
+		"<s0>a<s0>b</s0>", // nested tag
+		"<s5>a</s5>",      // unknown run
+		"<m0/>",           // text run used as placeholder
+		"<s1>a</s1>",      // placeholder used as text run
+		"<b>a</b>",        // unknown tag
+		"a <s0",           // unclosed tag
+		"",                // empty
+	} {
+		if _, err := DecodeRichtext(original, markup); err == nil {
+			t.Errorf("DecodeRichtext(%q) succeeded, want an error", markup)
+		}
+	}
+}
+
+func TestApplyTranslationPlain(t *testing.T) {
+	for _, traned := range []string{"x &lt; y &amp; z", "x < y & z"} {
+		richText := []notion.RichText{textRich("a < b & c", nil)}
+		if err := ApplyTranslation(&richText, traned); err != nil {
+			t.Fatal(err)
+		}
+		if got := richtextText(richText); got != "x < y & z" {
+			t.Errorf("ApplyTranslation(%q) = %q, want the unescaped text", traned, got)
+		}
+	}
+}
+
+func TestSegmentPlainChunks(t *testing.T) {
+	paragraph := notion.BlockDTO{Type: notion.BlockTypeParagraph, Paragraph: &notion.ParagraphBlock{
+		RichText: []notion.RichText{textRich(strings.Repeat("Tom & Jerry <3. ", 200), nil)},
+	}}
+	segments := CollectSegments([]notion.Block{paragraph}, false)
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments, want 1", len(segments))
+	}
+	chunks := segments[0].Chunks(MaxRichtextLength)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if strings.Contains(chunk, "<") || strings.Contains(strings.ReplaceAll(chunk, "&amp;", ""), "& ") {
+			t.Errorf("chunk %d is not escaped", i)
+		}
+	}
+	// translating every chunk as is gives back the text
+	if err := segments[0].ApplyChunks(chunks, chunks); err != nil {
+		t.Fatal(err)
+	}
+	if got := segments[0].Text(); got != strings.Repeat("Tom & Jerry <3. ", 200) {
+		t.Errorf("round trip differs from the text")
+	}
+}
+
+func TestStripMarkup(t *testing.T) {
+	got := StripMarkup("<s0>a &lt; b</s0> <m1/>&amp; c")
+	if want := "a < b & c"; got != want {
+		t.Errorf("StripMarkup() = %q, want %q", got, want)
+	}
+}
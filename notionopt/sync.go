@@ -0,0 +1,495 @@
+package notionopt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/cryptowizard0/notion2arweave/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// BlockRecord a block created on a translated page, kept to update the page
+// in place when the source is translated again, see SyncBlocks
+type BlockRecord struct {
+	// Key the source block id, unique among the siblings, see blockKeys
+	Key string `json:"key"`
+	// ID the created block id
+	ID   string           `json:"id"`
+	Type notion.BlockType `json:"type"`
+	// Hash of the block content without children
+	Hash     string        `json:"hash"`
+	Children []BlockRecord `json:"children,omitempty"`
+}
+
+// SyncBlocks making the children of a page or block match the blocks, in place.
+// Unchanged blocks are left untouched, changed blocks are updated, removed blocks
+// are archived and new blocks are inserted at their position.
+// Blocks which can't be updated, like a block with another type or a table
+// with another width, are archived and created again.
+// @Pararm previous, records returned by the last sync of the parent, nil for a new parent
+// @Pararm progress, called with the number of synced blocks, may be nil
+// @Return records of the blocks, for the next sync. On error the records of the
+// blocks on the parent so far are returned as well, see partialRecords
+func (n *NotionOperator) SyncBlocks(parentId string, blocks []notion.Block, previous []BlockRecord, progress func(count int)) ([]BlockRecord, error) {
+	keys := blockKeys(blocks)
+	hashes := make([]string, len(blocks))
+	for i, block := range blocks {
+		hashes[i] = blockHash(block)
+	}
+	kept := keptBlocks(blocks, keys, hashes, previous)
+
+	records := make([]BlockRecord, len(blocks))
+	// previous records synced so far
+	synced := make(map[int]bool, len(previous))
+	after := ""
+	for i := 0; i < len(blocks); {
+		if kept[i] < 0 {
+			// new blocks are inserted together after the last synced block
+			end := i + 1
+			for end < len(blocks) && kept[end] < 0 {
+				end++
+			}
+			created, err := n.insertBlocks(parentId, after, blocks[i:end], keys[i:end])
+			copy(records[i:], created)
+			if err != nil {
+				return partialRecords(records, previous, synced), err
+			}
+			after = created[len(created)-1].ID
+			if progress != nil {
+				progress(CountBlocks(blocks[i:end]))
+			}
+			i = end
+			continue
+		}
+
+		prev := previous[kept[i]]
+		record, err := n.syncBlock(prev, blocks[i], hashes[i])
+		if err != nil {
+			// deleted by hand or not updatable, create it again
+			log.Warnf("update block %s error: %s, creating it again", prev.ID, err)
+			kept[i] = -1
+			if after == "" {
+				// the first block, see keptBlocks
+				for k := range kept {
+					kept[k] = -1
+				}
+			}
+			continue
+		}
+		records[i] = record
+		synced[kept[i]] = true
+		after = record.ID
+		if progress != nil {
+			progress(CountBlocks(blocks[i : i+1]))
+		}
+		i++
+	}
+
+	// archived last, so that a column never gets empty,
+	// blocks which failed to update are archived as well
+	used := make(map[int]bool, len(kept))
+	for _, j := range kept {
+		used[j] = true
+	}
+	for j, prev := range previous {
+		if !used[j] {
+			n.archiveBlock(prev.ID)
+		}
+	}
+	return records, nil
+}
+
+// partialRecords the records of a sync stopped by an error: the blocks synced
+// or created so far, followed by the previous blocks not synced yet, which are
+// still on the parent. The next sync then neither creates the synced blocks
+// again nor leaves the others behind.
+func partialRecords(records, previous []BlockRecord, synced map[int]bool) []BlockRecord {
+	var result []BlockRecord
+	for _, record := range records {
+		if record.ID != "" {
+			result = append(result, record)
+		}
+	}
+	for j, prev := range previous {
+		if !synced[j] {
+			result = append(result, prev)
+		}
+	}
+	return result
+}
+
+// syncBlock updating a previously created block if its content changed,
+// then syncing its children
+func (n *NotionOperator) syncBlock(prev BlockRecord, block notion.Block, hash string) (BlockRecord, error) {
+	if hash != prev.Hash {
+		err := n.updateBlock(prev.ID, block)
+		if err != nil {
+			return BlockRecord{}, err
+		}
+	}
+	children, err := n.SyncBlocks(prev.ID, GetChildren(block), prev.Children, nil)
+	if err != nil {
+		return BlockRecord{}, err
+	}
+	return BlockRecord{
+		Key:      prev.Key,
+		ID:       prev.ID,
+		Type:     blockType(block),
+		Hash:     hash,
+		Children: children,
+	}, nil
+}
+
+// keptBlocks matching the blocks with the previous records they update in place
+// @Return for every block the index of its record, -1 if the block is created
+func keptBlocks(blocks []notion.Block, keys, hashes []string, previous []BlockRecord) []int {
+	index := make(map[string]int, len(previous))
+	for j, prev := range previous {
+		index[prev.Key] = j
+	}
+
+	kept := make([]int, len(blocks))
+	last := -1
+	for i, block := range blocks {
+		kept[i] = -1
+		j, ok := index[keys[i]]
+		if !ok || j <= last {
+			// new or moved
+			continue
+		}
+		prev := previous[j]
+		if prev.Type != blockType(block) || (prev.Hash != hashes[i] && !updatable(prev.Type)) {
+			continue
+		}
+		kept[i] = j
+		last = j
+	}
+
+	// notion inserts blocks after another block only, blocks before
+	// the first kept block can't be placed, so all blocks are created again
+	if len(kept) > 0 && kept[0] < 0 {
+		for i := range kept {
+			kept[i] = -1
+		}
+	}
+	return kept
+}
+
+// Blocks whose content can be replaced by the update block api,
+// tables can't change their width and column lists their columns
+func updatable(blockType notion.BlockType) bool {
+	switch blockType {
+	case notion.BlockTypeTable, notion.BlockTypeColumnList:
+		return false
+	default:
+		return true
+	}
+}
+
+// blockKeys keys identifying sibling blocks across translations: the source block id,
+// followed by a counter if repeated, like a source block and its translation
+// on a bilingual page, or by a counter alone for blocks without id
+func blockKeys(blocks []notion.Block) []string {
+	seen := make(map[string]int, len(blocks))
+	keys := make([]string, len(blocks))
+	for i, block := range blocks {
+		id := NormalizeID(block.ID())
+		seen[id]++
+		if id == "" || seen[id] > 1 {
+			keys[i] = fmt.Sprintf("%s#%d", id, seen[id])
+		} else {
+			keys[i] = id
+		}
+	}
+	return keys
+}
+
+// blockHash hash of the block content, nested children excluded
+// except the number of columns of a column list
+func blockHash(block notion.Block) string {
+	content, ok := blockContent(block)
+	if !ok {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte(content))
+	if blockType(block) == notion.BlockTypeColumnList {
+		fmt.Fprintf(h, "%d", len(GetChildren(block)))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// blockContent the type and content of the block, nested children excluded
+func blockContent(block notion.Block) (string, bool) {
+	t := blockType(block)
+	data, err := json.Marshal(withoutChildren(block))
+	if err != nil {
+		return "", false
+	}
+
+	payload := gjson.GetBytes(data, string(t))
+	switch t {
+	case notion.BlockTypeImage, notion.BlockTypeFile, notion.BlockTypePDF, notion.BlockTypeVideo, notion.BlockTypeAudio:
+		// the urls of files kept on notion are signed and expire, the expiry
+		// and the signed query change on every fetch, see StableRendering
+		return string(t) + payload.Get("caption").Raw +
+			StableRendering(payload.Get("file.url").String()) +
+			StableRendering(payload.Get("external.url").String()), true
+	default:
+		return string(t) + payload.Raw, true
+	}
+}
+
+func blockType(block notion.Block) notion.BlockType {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return ""
+	}
+	return dto.Type
+}
+
+// insertBlocks creating blocks and all their nested children after a child
+// of the parent, or at the end if after is empty
+// @Return records of the created blocks, on error of the blocks created so far.
+// A block whose children failed is recorded without hash, so that the next
+// sync updates it, or creates it again if it is not updatable.
+func (n *NotionOperator) insertBlocks(parentId, after string, blocks []notion.Block, keys []string) ([]BlockRecord, error) {
+	records := make([]BlockRecord, 0, len(blocks))
+	for start := 0; start < len(blocks); start += maxBlocksPerAppend {
+		end := start + maxBlocksPerAppend
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		batch := blocks[start:end]
+
+		toUpload := make([]notion.Block, len(batch))
+		for j, block := range batch {
+			toUpload[j] = uploadBlock(block)
+		}
+		ids, err := n.appendChildren(parentId, after, toUpload)
+		if err != nil {
+			return records, err
+		}
+
+		for j, block := range batch {
+			children, err := n.createNested(ids[j], block)
+			record := BlockRecord{
+				Key:      keys[start+j],
+				ID:       ids[j],
+				Type:     blockType(block),
+				Hash:     blockHash(block),
+				Children: children,
+			}
+			if err != nil {
+				record.Hash = ""
+				return append(records, record), err
+			}
+			records = append(records, record)
+		}
+		after = ids[len(ids)-1]
+	}
+	return records, nil
+}
+
+// createNested creating the children of a created block
+// which were not sent along with it, see uploadBlock
+// @Return records of all the children
+func (n *NotionOperator) createNested(blockId string, block notion.Block) ([]BlockRecord, error) {
+	children := GetChildren(block)
+	if len(children) == 0 {
+		return nil, nil
+	}
+	keys := blockKeys(children)
+
+	switch blockType(block) {
+	case notion.BlockTypeTable:
+		// the first rows are created with the table
+		return n.createdChildren(blockId, children, keys, len(inlineChildren(children)))
+	case notion.BlockTypeColumnList:
+		// columns and their first blocks are created with the list
+		columnIds, err := n.childBlockIDs(blockId)
+		if err != nil {
+			return nil, err
+		}
+		if len(columnIds) != len(children) {
+			return nil, fmt.Errorf("append columns: expect %d columns, got %d", len(children), len(columnIds))
+		}
+		records := make([]BlockRecord, len(children))
+		for i, column := range children {
+			content := GetChildren(column)
+			var contentRecords []BlockRecord
+			if inline := len(columnInline(content)); inline > 0 || len(content) == 0 {
+				contentRecords, err = n.createdChildren(columnIds[i], content, blockKeys(content), inline)
+			} else {
+				contentRecords, err = n.replacePlaceholder(columnIds[i], content, blockKeys(content))
+			}
+			if err != nil {
+				return nil, err
+			}
+			records[i] = BlockRecord{
+				Key:      keys[i],
+				ID:       columnIds[i],
+				Type:     notion.BlockTypeColumn,
+				Hash:     blockHash(column),
+				Children: contentRecords,
+			}
+		}
+		return records, nil
+	default:
+		return n.insertBlocks(blockId, "", children, keys)
+	}
+}
+
+// createdChildren records of the first children, created along with their parent,
+// their nested children and the remaining children are created here
+func (n *NotionOperator) createdChildren(parentId string, children []notion.Block, keys []string, inline int) ([]BlockRecord, error) {
+	if inline == 0 {
+		return nil, nil
+	}
+	ids, err := n.childBlockIDs(parentId)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != inline {
+		return nil, fmt.Errorf("append blocks: expect %d created blocks, got %d", inline, len(ids))
+	}
+
+	records := make([]BlockRecord, 0, len(children))
+	for j, child := range children[:inline] {
+		nested, err := n.createNested(ids[j], child)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, BlockRecord{
+			Key:      keys[j],
+			ID:       ids[j],
+			Type:     blockType(child),
+			Hash:     blockHash(child),
+			Children: nested,
+		})
+	}
+	rest, err := n.insertBlocks(parentId, ids[inline-1], children[inline:], keys[inline:])
+	if err != nil {
+		return nil, err
+	}
+	return append(records, rest...), nil
+}
+
+// replacePlaceholder creating the children of a column created with
+// an empty paragraph only, see uploadBlock, then archiving the paragraph
+func (n *NotionOperator) replacePlaceholder(columnId string, children []notion.Block, keys []string) ([]BlockRecord, error) {
+	ids, err := n.childBlockIDs(columnId)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != 1 {
+		return nil, fmt.Errorf("append columns: expect 1 created block, got %d", len(ids))
+	}
+	records, err := n.insertBlocks(columnId, ids[0], children, keys)
+	if err != nil {
+		return nil, err
+	}
+	n.archiveBlock(ids[0])
+	return records, nil
+}
+
+// appendChildren appending blocks to the parent after one of its children,
+// or at the end if after is empty
+// @Return ids of the created blocks, in order
+func (n *NotionOperator) appendChildren(parentId, after string, blocks []notion.Block) ([]string, error) {
+	body := map[string]interface{}{"children": blocks}
+	if after != "" {
+		body["after"] = after
+	}
+	resp, err := n.httpClient.R().SetBody(body).Patch(fmt.Sprintf("/v1/blocks/%s/children", parentId))
+	if err != nil {
+		log.Error("patch request error:", err.Error())
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		utils.LogResp_Error(resp)
+		return nil, fmt.Errorf(resp.String())
+	}
+
+	var ids []string
+	for _, result := range gjson.Get(resp.String(), "results").Array() {
+		ids = append(ids, result.Get("id").String())
+	}
+	if len(ids) != len(blocks) {
+		return nil, fmt.Errorf("append blocks: expect %d created blocks, got %d", len(blocks), len(ids))
+	}
+	return ids, nil
+}
+
+// updateBlock replacing the content of a block, its children are left untouched
+func (n *NotionOperator) updateBlock(blockId string, block notion.Block) error {
+	t := blockType(block)
+	data, err := json.Marshal(withoutChildren(block))
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(`{%q:%s}`, t, gjson.GetBytes(data, string(t)).Raw)
+
+	resp, err := n.httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Patch("/v1/blocks/" + blockId)
+	if err != nil {
+		log.Error("patch request error:", err.Error())
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		utils.LogResp_Error(resp)
+		return fmt.Errorf(resp.String())
+	}
+	return nil
+}
+
+// archiveBlock archiving a block with its children,
+// failures are only logged as the block may be deleted by hand
+func (n *NotionOperator) archiveBlock(blockId string) {
+	_, err := n.notionClient.DeleteBlock(context.Background(), blockId)
+	if err != nil {
+		log.Warnf("archive block %s error: %s", blockId, err)
+	}
+}
+
+// PageExists returns false if the page is archived or can't be found
+func (n *NotionOperator) PageExists(pageId string) bool {
+	page, err := n.notionClient.FindPageByID(context.Background(), pageId)
+	if err != nil {
+		log.Warnf("find page %s error: %s", pageId, err)
+		return false
+	}
+	return !page.Archived
+}
+
+// Fingerprint identifies the content of a source block,
+// a block with the same fingerprint needs no new translation
+type Fingerprint struct {
+	ID             string    `json:"id"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+	// Hash of the block content without children,
+	// notion rounds the edit time to the minute
+	Hash string `json:"hash"`
+}
+
+// BlockFingerprint returns the fingerprint of a block fetched from notion
+func BlockFingerprint(block notion.Block) Fingerprint {
+	return Fingerprint{
+		ID:             NormalizeID(block.ID()),
+		LastEditedTime: block.LastEditedTime(),
+		Hash:           blockHash(block),
+	}
+}
+
+func (f Fingerprint) Equal(other Fingerprint) bool {
+	return f.ID == other.ID && f.LastEditedTime.Equal(other.LastEditedTime) && f.Hash == other.Hash
+}
@@ -0,0 +1,132 @@
+package notionopt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+func withID(block notion.Block, id string) notion.Block {
+	dto := block.(notion.BlockDTO)
+	dto.BID = id
+	return dto
+}
+
+func image(url string, file bool, caption string) notion.Block {
+	img := &notion.ImageBlock{Caption: []notion.RichText{textRich(caption, nil)}}
+	if file {
+		img.Type = notion.FileTypeFile
+		img.File = &notion.FileFile{URL: url, ExpiryTime: notion.NewDateTime(time.Now(), true)}
+	} else {
+		img.Type = notion.FileTypeExternal
+		img.External = &notion.FileExternal{URL: url}
+	}
+	return notion.BlockDTO{Type: notion.BlockTypeImage, Image: img}
+}
+
+func TestBlockKeys(t *testing.T) {
+	blocks := []notion.Block{
+		withID(paragraph(textRich("a", nil)), "AAAA-1"),
+		withID(paragraph(textRich("b", nil)), "bbbb-2"),
+		withID(paragraph(textRich("a translated", nil)), "aaaa1"),
+		paragraph(textRich("new", nil)),
+		paragraph(textRich("new", nil)),
+	}
+	got := blockKeys(blocks)
+	want := []string{"aaaa1", "bbbb2", "aaaa1#2", "#1", "#2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blockKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestKeptBlocks(t *testing.T) {
+	para := paragraph(textRich("p", nil))
+	tbl := table(false, []string{"a", "b"})
+	record := func(key string, blockType notion.BlockType, hash string) BlockRecord {
+		return BlockRecord{Key: key, ID: "id-" + key, Type: blockType, Hash: hash}
+	}
+	previous := []BlockRecord{
+		record("a", notion.BlockTypeParagraph, "ha"),
+		record("b", notion.BlockTypeParagraph, "hb"),
+		record("t", notion.BlockTypeTable, "ht"),
+	}
+	tests := []struct {
+		name   string
+		blocks []notion.Block
+		keys   []string
+		hashes []string
+		want   []int
+	}{
+		{"unchanged", []notion.Block{para, para, tbl}, []string{"a", "b", "t"}, []string{"ha", "hb", "ht"}, []int{0, 1, 2}},
+		{"changed paragraph updated", []notion.Block{para, para, tbl}, []string{"a", "b", "t"}, []string{"ha", "new", "ht"}, []int{0, 1, 2}},
+		{"changed table created", []notion.Block{para, para, tbl}, []string{"a", "b", "t"}, []string{"ha", "hb", "new"}, []int{0, 1, -1}},
+		{"inserted", []notion.Block{para, para, para}, []string{"a", "x", "b"}, []string{"ha", "hx", "hb"}, []int{0, -1, 1}},
+		{"removed", []notion.Block{para, tbl}, []string{"a", "t"}, []string{"ha", "ht"}, []int{0, 2}},
+		{"moved", []notion.Block{para, para}, []string{"b", "a"}, []string{"hb", "ha"}, []int{1, -1}},
+		{"type changed", []notion.Block{para, tbl}, []string{"a", "b"}, []string{"ha", "hb"}, []int{0, -1}},
+		{"first not kept", []notion.Block{para, para, para}, []string{"x", "a", "b"}, []string{"hx", "ha", "hb"}, []int{-1, -1, -1}},
+		{"first changed type", []notion.Block{tbl, para}, []string{"a", "b"}, []string{"ha", "hb"}, []int{-1, -1}},
+		{"no previous", []notion.Block{para}, []string{"a"}, []string{"ha"}, []int{-1}},
+		{"no blocks", nil, nil, nil, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := previous
+			if tt.name == "no previous" {
+				prev = nil
+			}
+			if got := keptBlocks(tt.blocks, tt.keys, tt.hashes, prev); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keptBlocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockHash(t *testing.T) {
+	signed := func(signature string) string {
+		return "https://prod-files-secure.s3.us-west-2.amazonaws.com/space/file/cat.png?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=" + signature
+	}
+	tests := []struct {
+		name  string
+		a, b  notion.Block
+		equal bool
+	}{
+		{"same text", paragraph(textRich("a", nil)), paragraph(textRich("a", nil)), true},
+		{"other text", paragraph(textRich("a", nil)), paragraph(textRich("b", nil)), false},
+		{"children ignored", bulleted("a", paragraph(textRich("x", nil))), bulleted("a"), true},
+		{"columns counted", columnList(1), columnList(2), false},
+		{"signed file url", image(signed("1"), true, "cat"), image(signed("2"), true, "cat"), true},
+		{"signed external url", image(signed("1"), false, "cat"), image(signed("2"), false, "cat"), true},
+		{"other file", image(signed("1"), true, "cat"), image("https://prod-files-secure.s3.us-west-2.amazonaws.com/space/other/dog.png?X-Amz-Signature=1", true, "cat"), false},
+		{"other caption", image(signed("1"), false, "cat"), image(signed("1"), false, "dog"), false},
+		{"external query kept", image("https://example.com/a.png?w=1", false, ""), image("https://example.com/a.png?w=2", false, ""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockHash(tt.a) == blockHash(tt.b); got != tt.equal {
+				t.Errorf("equal hashes = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func columnList(columns int) notion.Block {
+	children := make([]notion.ColumnBlock, columns)
+	for i := range children {
+		children[i] = notion.ColumnBlock{Children: []notion.Block{paragraph(textRich("c", nil))}}
+	}
+	return notion.BlockDTO{Type: notion.BlockTypeColumnList, ColumnList: &notion.ColumnListBlock{Children: children}}
+}
+
+func TestPartialRecords(t *testing.T) {
+	previous := []BlockRecord{{Key: "a", ID: "1"}, {Key: "b", ID: "2"}, {Key: "c", ID: "3"}}
+	// "a" synced, "x" created, the sync failed before "b" and "c"
+	records := []BlockRecord{{Key: "a", ID: "1"}, {Key: "x", ID: "9"}, {}, {}}
+	got := partialRecords(records, previous, map[int]bool{0: true})
+	want := []BlockRecord{{Key: "a", ID: "1"}, {Key: "x", ID: "9"}, {Key: "b", ID: "2"}, {Key: "c", ID: "3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("partialRecords() = %+v, want %+v", got, want)
+	}
+}
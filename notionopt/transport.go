@@ -0,0 +1,182 @@
+package notionopt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/permadao/transbot/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrRetryExhausted matches every RetryExhaustedError with errors.Is
+var ErrRetryExhausted = errors.New("notion request retries exhausted")
+
+// RetryExhaustedError a notion request still failing after all retries
+type RetryExhaustedError struct {
+	Method   string
+	URL      string
+	Attempts int
+	// StatusCode of the last response, 0 if the last attempt failed in transport
+	StatusCode int
+	// Err of the last attempt failed in transport
+	Err error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("notion: %s %s failed after %d attempts, status code: %d", e.Method, e.URL, e.Attempts, e.StatusCode)
+	}
+	return fmt.Sprintf("notion: %s %s failed after %d attempts: %v", e.Method, e.URL, e.Attempts, e.Err)
+}
+
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryExhaustedError) Is(target error) bool {
+	return target == ErrRetryExhausted
+}
+
+// RateLimited the last attempt was rejected by the notion rate limit
+func (e *RetryExhaustedError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// RetryTransport the request layer shared by all notion api calls.
+// Enforces the client side rate limit, retries 429 responses, and 5xx responses
+// of reads, honouring Retry-After, and backs off exponentially with jitter otherwise.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	Limiter    *utils.Limiter
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		err := t.Limiter.Wait(ctx, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		try := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			try = req.Clone(ctx)
+			try.Body = body
+		}
+
+		resp, err := base.RoundTrip(try)
+		if !retryable(ctx, req, resp, err) {
+			return resp, err
+		}
+		// a body which can not be replayed can not be retried
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		delay := utils.Backoff(attempt, t.BaseDelay, t.MaxDelay)
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+			if after, ok := utils.RetryAfter(resp.Header); ok {
+				delay = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if attempt >= t.MaxRetries {
+			return nil, &RetryExhaustedError{
+				Method:     req.Method,
+				URL:        req.URL.Path,
+				Attempts:   attempt + 1,
+				StatusCode: statusCode,
+				Err:        err,
+			}
+		}
+		log.Warnf("notion: %s %s attempt %d failed (status %d, err %v), retry in %s",
+			req.Method, req.URL.Path, attempt+1, statusCode, err, delay)
+		err = utils.Sleep(ctx, delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newRetryTransport creating the notion request layer from config
+func newRetryTransport() *RetryTransport {
+	rate := viper.GetFloat64("notion.rate_limit")
+	if rate == 0 {
+		rate = 3
+	}
+	maxRetries := 5
+	if viper.IsSet("notion.max_retries") {
+		maxRetries = viper.GetInt("notion.max_retries")
+	}
+	baseDelay := viper.GetDuration("notion.retry_base_delay")
+	if baseDelay <= 0 {
+		baseDelay = 500 * time.Millisecond
+	}
+	maxDelay := viper.GetDuration("notion.retry_max_delay")
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	return &RetryTransport{
+		Limiter:    utils.NewLimiter(rate, rate),
+		MaxRetries: maxRetries,
+		BaseDelay:  baseDelay,
+		MaxDelay:   maxDelay,
+	}
+}
+
+// retryable rate limited requests are always retried.
+// Server errors and transport errors are retried for reads only, a write may
+// have been committed by notion before the response was lost, so writes are
+// retried on transport errors only when the connection was never made.
+func retryable(ctx context.Context, req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		return idempotent(req.Method) || notConnected(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return idempotent(req.Method)
+	default:
+		return false
+	}
+}
+
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// notConnected the request failed while dialing, so it never reached notion
+func notConnected(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
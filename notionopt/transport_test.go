@@ -0,0 +1,71 @@
+package notionopt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		status   int
+		attempts int32
+	}{
+		{"read server error", http.MethodGet, http.StatusBadGateway, 3},
+		{"write server error", http.MethodPost, http.StatusBadGateway, 1},
+		{"write rate limited", http.MethodPatch, http.StatusTooManyRequests, 3},
+		{"read bad request", http.MethodGet, http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: &RetryTransport{
+				MaxRetries: 2,
+				BaseDelay:  time.Millisecond,
+				MaxDelay:   time.Millisecond,
+			}}
+			req, err := http.NewRequest(tt.method, server.URL+"/v1/pages", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransportDialError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := &http.Client{Transport: &RetryTransport{
+		MaxRetries: 1,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Millisecond,
+	}}
+	req, err := http.NewRequest(http.MethodPost, url+"/v1/pages", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Do(req)
+	if err == nil || !strings.Contains(err.Error(), "failed after 2 attempts") {
+		t.Errorf("a write that never connected should be retried, got %v", err)
+	}
+}
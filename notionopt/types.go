@@ -1,6 +1,7 @@
 package notionopt
 
 import (
+	"encoding/json"
 	"errors"
 
 	"github.com/cryptowizard0/go-notion"
@@ -10,10 +11,31 @@ var (
 	ErrBlockTypeUnsportected = errors.New("unsportected block type")
 	ErrConvertDOTFailed      = errors.New("convert to notion.BlockDTO failed")
 	ErrRichtextIsNull        = errors.New("the text is null")
+	ErrNoTitleProperty       = errors.New("page has no title property")
+	ErrUnknownParent         = errors.New("neither a database nor a page")
 )
 
+// TranslateFunc translating the content, used to plug the translator into notionopt
+type TranslateFunc func(content string) (string, error)
+
 // notion page
 type NotionPage struct {
 	PageInfo    notion.Page                  `json:"page_info"`
 	PageContent notion.BlockChildrenResponse `json:"page_content"`
 }
+
+// rawBlock a block sent as {"type": <type>, <type>: <payload>},
+// for block types the sdk can't marshal for creation
+type rawBlock struct {
+	notion.BaseBlock
+	blockType notion.BlockType
+	payload   interface{}
+}
+
+func (b rawBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"object":            "block",
+		"type":              b.blockType,
+		string(b.blockType): b.payload,
+	})
+}
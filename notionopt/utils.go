@@ -1,7 +1,9 @@
 package notionopt
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/cryptowizard0/go-notion"
 	"github.com/tidwall/gjson"
@@ -35,6 +37,32 @@ func MergeChildBlocks(content1, content2 string) (merged string, err error) {
 	return merged, nil
 }
 
+// AttachChildBlocks
+// attach the children content to a single block JSON string as "children"
+// children format is notion.BlockChildrenResponse
+func AttachChildBlocks(block, children string) (attached string, err error) {
+	block = strings.TrimSpace(block)
+	if !strings.HasSuffix(block, "}") || !gjson.Valid(children) {
+		return "", fmt.Errorf("attach child blocks: invalid json")
+	}
+	attached = fmt.Sprintf("%s,\"children\":%s}", strings.TrimSuffix(block, "}"), children)
+	return attached, nil
+}
+
+// ReplaceChildBlocks
+// replace the results of content by the given block JSON strings
+// content format is notion.BlockChildrenResponse
+func ReplaceChildBlocks(content string, blocks []string) (replaced string, err error) {
+	replaced = fmt.Sprintf("{\"object\":\"%s\",\"results\":[%s],\"type\":\"%s\"}",
+		gjson.Get(content, "object").String(),
+		strings.Join(blocks, ","),
+		gjson.Get(content, "type").String())
+	if !gjson.Valid(replaced) {
+		return "", fmt.Errorf("replace child blocks: invalid json")
+	}
+	return replaced, nil
+}
+
 // Get string block content
 func GetBlockContent(block notion.Block) (string, error) {
 	dto, ok := block.(notion.BlockDTO)
@@ -79,7 +107,17 @@ func ReplaceRichtext(richtext *[]notion.RichText, newContent string) error {
 		return ErrRichtextIsNull
 	}
 	*richtext = (*richtext)[0:1]
+	if (*richtext)[0].Text == nil {
+		// first one is a mention or equation, replace it by a text run
+		(*richtext)[0] = notion.RichText{
+			Type:        notion.RichTextTypeText,
+			Annotations: (*richtext)[0].Annotations,
+			Text:        &notion.Text{},
+		}
+	}
 	(*richtext)[0].Text.Content = newContent
+	// content over the notion length limit goes to several runs
+	*richtext = SplitRichtext(*richtext)
 	return nil
 }
 
@@ -124,11 +162,99 @@ func GetRichtext(block notion.Block) (*[]notion.RichText, error) {
 func GetFullRichtext(richText []notion.RichText) string {
 	fullContent := ""
 	for _, rt := range richText {
-		fullContent += rt.Text.Content
+		if rt.Text != nil {
+			fullContent += rt.Text.Content
+		} else {
+			fullContent += rt.PlainText
+		}
 	}
 	return fullContent
 }
 
+// GetPropertyText
+// Plain text value of a database page property, empty for non text properties.
+func GetPropertyText(prop notion.DatabasePageProperty) string {
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		return GetFullRichtext(prop.Title)
+	case notion.DBPropTypeRichText:
+		return GetFullRichtext(prop.RichText)
+	case notion.DBPropTypeSelect:
+		if prop.Select != nil {
+			return prop.Select.Name
+		}
+	case notion.DBPropTypeURL:
+		if prop.URL != nil {
+			return *prop.URL
+		}
+	}
+	return ""
+}
+
+// PropertyValue
+// Value of a database page property as sent to create a page.
+// @Return false for empty and read only properties
+func PropertyValue(prop notion.DatabasePageProperty) (interface{}, bool) {
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		return prop.Title, true
+	case notion.DBPropTypeRichText:
+		return prop.RichText, len(prop.RichText) > 0
+	case notion.DBPropTypeNumber:
+		return prop.Number, prop.Number != nil
+	case notion.DBPropTypeCheckbox:
+		return prop.Checkbox, prop.Checkbox != nil
+	case notion.DBPropTypeURL:
+		return prop.URL, prop.URL != nil
+	case notion.DBPropTypeEmail:
+		return prop.Email, prop.Email != nil
+	case notion.DBPropTypePhoneNumber:
+		return prop.PhoneNumber, prop.PhoneNumber != nil
+	case notion.DBPropTypeDate:
+		return prop.Date, prop.Date != nil
+	case notion.DBPropTypeSelect:
+		if prop.Select == nil {
+			return nil, false
+		}
+		// options are matched by name, ids belong to the source database
+		return map[string]string{"name": prop.Select.Name}, true
+	case notion.DBPropTypeStatus:
+		if prop.Status == nil {
+			return nil, false
+		}
+		return map[string]string{"name": prop.Status.Name}, true
+	case notion.DBPropTypeMultiSelect:
+		options := make([]map[string]string, len(prop.MultiSelect))
+		for i, option := range prop.MultiSelect {
+			options[i] = map[string]string{"name": option.Name}
+		}
+		return options, len(options) > 0
+	case notion.DBPropTypeRelation:
+		relations := make([]map[string]string, len(prop.Relation))
+		for i, relation := range prop.Relation {
+			relations[i] = map[string]string{"id": relation.ID}
+		}
+		return relations, len(relations) > 0
+	case notion.DBPropTypePeople:
+		people := make([]map[string]string, len(prop.People))
+		for i, user := range prop.People {
+			people[i] = map[string]string{"object": "user", "id": user.ID}
+		}
+		return people, len(people) > 0
+	case notion.DBPropTypeFiles:
+		// files uploaded to notion can't be set by the api
+		var files []notion.File
+		for _, file := range prop.Files {
+			if file.Type == notion.FileTypeExternal {
+				files = append(files, file)
+			}
+		}
+		return files, len(files) > 0
+	default:
+		return nil, false
+	}
+}
+
 // Supported block types
 func IsSupported(dto *notion.BlockDTO) bool {
 	switch dto.Type {
@@ -143,9 +269,328 @@ func IsSupported(dto *notion.BlockDTO) bool {
 		notion.BlockTypeCallout,
 		notion.BlockTypeVideo,
 		notion.BlockTypeQuote,
-		notion.BlockTypeImage:
+		notion.BlockTypeImage,
+		notion.BlockTypeCode,
+		notion.BlockTypeTable,
+		notion.BlockTypeTableRow,
+		notion.BlockTypeColumnList,
+		notion.BlockTypeColumn,
+		notion.BlockTypeDivider,
+		notion.BlockTypeBookmark,
+		notion.BlockTypeEquation,
+		notion.BlockTypeEmbed,
+		notion.BlockTypeFile,
+		notion.BlockTypePDF:
+		return true
+	default:
+		return false
+	}
+}
+
+// Block types whose nested children are fetched and rebuilt
+func canHaveChildren(blockType notion.BlockType) bool {
+	switch blockType {
+	case notion.BlockTypeParagraph,
+		notion.BlockTypeHeading1,
+		notion.BlockTypeHeading2,
+		notion.BlockTypeHeading3,
+		notion.BlockTypeBulletedListItem,
+		notion.BlockTypeNumberedListItem,
+		notion.BlockTypeToDo,
+		notion.BlockTypeToggle,
+		notion.BlockTypeCallout,
+		notion.BlockTypeQuote,
+		notion.BlockTypeTable,
+		notion.BlockTypeColumnList,
+		notion.BlockTypeColumn:
 		return true
 	default:
 		return false
 	}
 }
+
+// GetChildren returns the nested child blocks of a block.
+// Columns of a column list are returned as blocks sharing the column content.
+func GetChildren(block notion.Block) []notion.Block {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return nil
+	}
+
+	switch dto.Type {
+	case notion.BlockTypeParagraph:
+		return dto.Paragraph.Children
+	case notion.BlockTypeHeading1:
+		return dto.Heading1.Children
+	case notion.BlockTypeHeading2:
+		return dto.Heading2.Children
+	case notion.BlockTypeHeading3:
+		return dto.Heading3.Children
+	case notion.BlockTypeNumberedListItem:
+		return dto.NumberedListItem.Children
+	case notion.BlockTypeBulletedListItem:
+		return dto.BulletedListItem.Children
+	case notion.BlockTypeToDo:
+		return dto.ToDo.Children
+	case notion.BlockTypeToggle:
+		return dto.Toggle.Children
+	case notion.BlockTypeCallout:
+		return dto.Callout.Children
+	case notion.BlockTypeQuote:
+		return dto.Quote.Children
+	case notion.BlockTypeTable:
+		return dto.Table.Children
+	case notion.BlockTypeColumn:
+		return dto.Column.Children
+	case notion.BlockTypeColumnList:
+		columns := make([]notion.Block, len(dto.ColumnList.Children))
+		for i := range dto.ColumnList.Children {
+			columns[i] = notion.BlockDTO{
+				Type:   notion.BlockTypeColumn,
+				Column: &dto.ColumnList.Children[i],
+			}
+		}
+		return columns
+	default:
+		return nil
+	}
+}
+
+// CountBlocks counting blocks including all nested children
+func CountBlocks(blocks []notion.Block) int {
+	count := 0
+	for _, block := range blocks {
+		count += 1 + CountBlocks(GetChildren(block))
+	}
+	return count
+}
+
+// SetChildren replaces the nested child blocks of a block
+func SetChildren(block notion.Block, children []notion.Block) error {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return ErrConvertDOTFailed
+	}
+
+	switch dto.Type {
+	case notion.BlockTypeParagraph:
+		dto.Paragraph.Children = children
+	case notion.BlockTypeHeading1:
+		dto.Heading1.Children = children
+	case notion.BlockTypeHeading2:
+		dto.Heading2.Children = children
+	case notion.BlockTypeHeading3:
+		dto.Heading3.Children = children
+	case notion.BlockTypeNumberedListItem:
+		dto.NumberedListItem.Children = children
+	case notion.BlockTypeBulletedListItem:
+		dto.BulletedListItem.Children = children
+	case notion.BlockTypeToDo:
+		dto.ToDo.Children = children
+	case notion.BlockTypeToggle:
+		dto.Toggle.Children = children
+	case notion.BlockTypeCallout:
+		dto.Callout.Children = children
+	case notion.BlockTypeQuote:
+		dto.Quote.Children = children
+	case notion.BlockTypeTable:
+		dto.Table.Children = children
+	case notion.BlockTypeColumn:
+		dto.Column.Children = children
+	case notion.BlockTypeColumnList:
+		columns := make([]notion.ColumnBlock, 0, len(children))
+		for _, child := range children {
+			column, ok := child.(notion.BlockDTO)
+			if !ok || column.Column == nil {
+				return ErrBlockTypeUnsportected
+			}
+			columns = append(columns, *column.Column)
+		}
+		dto.ColumnList.Children = columns
+	default:
+		if len(children) > 0 {
+			return ErrBlockTypeUnsportected
+		}
+	}
+	return nil
+}
+
+// withoutChildren returns a copy of the block without nested children,
+// the original block is left untouched.
+func withoutChildren(block notion.Block) notion.Block {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok || len(GetChildren(block)) == 0 {
+		return block
+	}
+
+	switch dto.Type {
+	case notion.BlockTypeParagraph:
+		tmp := *dto.Paragraph
+		tmp.Children = nil
+		dto.Paragraph = &tmp
+	case notion.BlockTypeHeading1:
+		tmp := *dto.Heading1
+		tmp.Children = nil
+		dto.Heading1 = &tmp
+	case notion.BlockTypeHeading2:
+		tmp := *dto.Heading2
+		tmp.Children = nil
+		dto.Heading2 = &tmp
+	case notion.BlockTypeHeading3:
+		tmp := *dto.Heading3
+		tmp.Children = nil
+		dto.Heading3 = &tmp
+	case notion.BlockTypeNumberedListItem:
+		tmp := *dto.NumberedListItem
+		tmp.Children = nil
+		dto.NumberedListItem = &tmp
+	case notion.BlockTypeBulletedListItem:
+		tmp := *dto.BulletedListItem
+		tmp.Children = nil
+		dto.BulletedListItem = &tmp
+	case notion.BlockTypeToDo:
+		tmp := *dto.ToDo
+		tmp.Children = nil
+		dto.ToDo = &tmp
+	case notion.BlockTypeToggle:
+		tmp := *dto.Toggle
+		tmp.Children = nil
+		dto.Toggle = &tmp
+	case notion.BlockTypeCallout:
+		tmp := *dto.Callout
+		tmp.Children = nil
+		dto.Callout = &tmp
+	case notion.BlockTypeQuote:
+		tmp := *dto.Quote
+		tmp.Children = nil
+		dto.Quote = &tmp
+	case notion.BlockTypeTable:
+		tmp := *dto.Table
+		tmp.Children = nil
+		dto.Table = &tmp
+	case notion.BlockTypeColumn:
+		dto.Column = &notion.ColumnBlock{}
+	case notion.BlockTypeColumnList:
+		dto.ColumnList = &notion.ColumnListBlock{}
+	}
+	return dto
+}
+
+// CloneBlocks returns a deep copy of the blocks and all their nested children
+func CloneBlocks(blocks []notion.Block) ([]notion.Block, error) {
+	clones := make([]notion.Block, len(blocks))
+	for i, block := range blocks {
+		data, err := json.Marshal(withoutChildren(block))
+		if err != nil {
+			return nil, err
+		}
+		var dto notion.BlockDTO
+		err = json.Unmarshal(data, &dto)
+		if err != nil {
+			return nil, err
+		}
+
+		children, err := CloneBlocks(GetChildren(block))
+		if err != nil {
+			return nil, err
+		}
+		err = SetChildren(dto, children)
+		if err != nil {
+			return nil, err
+		}
+		clones[i] = dto
+	}
+	return clones, nil
+}
+
+// ClonePage returns a deep copy of the page info and content
+func ClonePage(page *NotionPage) (*NotionPage, error) {
+	data, err := json.Marshal(page.PageInfo)
+	if err != nil {
+		return nil, err
+	}
+	clone := &NotionPage{PageContent: page.PageContent}
+	err = json.Unmarshal(data, &clone.PageInfo)
+	if err != nil {
+		return nil, err
+	}
+	clone.PageContent.Results, err = CloneBlocks(page.PageContent.Results)
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// uploadBlock returns the block to be sent to notion for creation.
+// Nested children are stripped and appended afterwards, except table rows
+// and columns which notion requires to be created with their parent.
+// The first blocks of a column are sent along with it without their children,
+// notion accepts two levels of nesting in one request, see columnInline.
+func uploadBlock(block notion.Block) notion.Block {
+	dto, ok := block.(notion.BlockDTO)
+	if !ok {
+		return block
+	}
+
+	switch dto.Type {
+	case notion.BlockTypeDivider:
+		// the sdk can't marshal dividers for creation
+		return rawBlock{blockType: dto.Type, payload: struct{}{}}
+	case notion.BlockTypeTable:
+		if len(dto.Table.Children) > maxBlocksPerAppend {
+			tmp := *dto.Table
+			tmp.Children = tmp.Children[:maxBlocksPerAppend]
+			dto.Table = &tmp
+		}
+		return dto
+	case notion.BlockTypeColumnList:
+		columns := make([]rawBlock, len(dto.ColumnList.Children))
+		for i, column := range dto.ColumnList.Children {
+			children := columnInline(column.Children)
+			inline := make([]notion.Block, len(children))
+			for j, child := range children {
+				inline[j] = uploadBlock(child)
+			}
+			if len(inline) == 0 {
+				// notion rejects empty columns
+				inline = append(inline, notion.BlockDTO{
+					Type:      notion.BlockTypeParagraph,
+					Paragraph: &notion.ParagraphBlock{RichText: []notion.RichText{}},
+				})
+			}
+			columns[i] = rawBlock{
+				blockType: notion.BlockTypeColumn,
+				payload:   map[string]interface{}{"children": inline},
+			}
+		}
+		return rawBlock{
+			blockType: dto.Type,
+			payload:   map[string]interface{}{"children": columns},
+		}
+	default:
+		return withoutChildren(block)
+	}
+}
+
+// Children created along with their parent, at most one append request
+func inlineChildren(children []notion.Block) []notion.Block {
+	if len(children) > maxBlocksPerAppend {
+		return children[:maxBlocksPerAppend]
+	}
+	return children
+}
+
+// Blocks of a column created along with the column, up to the first block
+// created with its own children, like a table with its rows, which would
+// be nested three levels deep. That block and the following ones are
+// appended to the column afterwards, see createNested.
+func columnInline(children []notion.Block) []notion.Block {
+	children = inlineChildren(children)
+	for i, child := range children {
+		switch blockType(child) {
+		case notion.BlockTypeTable, notion.BlockTypeColumnList:
+			return children[:i]
+		}
+	}
+	return children
+}
@@ -0,0 +1,86 @@
+package notionopt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/tidwall/gjson"
+)
+
+func columns(contents ...[]notion.Block) notion.Block {
+	children := make([]notion.ColumnBlock, len(contents))
+	for i, content := range contents {
+		children[i] = notion.ColumnBlock{Children: content}
+	}
+	return notion.BlockDTO{Type: notion.BlockTypeColumnList, ColumnList: &notion.ColumnListBlock{Children: children}}
+}
+
+// nesting the deepest level of children in a block sent to notion
+func nesting(block gjson.Result) int {
+	deepest := 0
+	for _, child := range block.Get(block.Get("type").String() + ".children").Array() {
+		if depth := nesting(child) + 1; depth > deepest {
+			deepest = depth
+		}
+	}
+	return deepest
+}
+
+func TestUploadBlockColumns(t *testing.T) {
+	tbl := table(true, []string{"a", "b"}, []string{"c", "d"})
+	tests := []struct {
+		name   string
+		block  notion.Block
+		inline []int
+	}{
+		{"paragraphs", columns([]notion.Block{paragraph(textRich("a", nil))}, []notion.Block{paragraph(textRich("b", nil))}), []int{1, 1}},
+		{"nested list", columns([]notion.Block{bulleted("a", bulleted("b", bulleted("c")))}), []int{1}},
+		{"table after a paragraph", columns([]notion.Block{paragraph(textRich("a", nil)), tbl, paragraph(textRich("b", nil))}), []int{1}},
+		{"table first", columns([]notion.Block{tbl}, []notion.Block{paragraph(textRich("b", nil))}), []int{1, 1}},
+		{"empty column", columns(nil), []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(uploadBlock(tt.block))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sent := gjson.ParseBytes(data)
+			if depth := nesting(sent); depth > 2 {
+				t.Errorf("children nested %d levels deep: %s", depth, data)
+			}
+			cols := sent.Get("column_list.children").Array()
+			if len(cols) != len(tt.inline) {
+				t.Fatalf("sent %d columns, want %d", len(cols), len(tt.inline))
+			}
+			for i, col := range cols {
+				if n := len(col.Get("column.children").Array()); n != tt.inline[i] {
+					t.Errorf("column %d sent with %d blocks, want %d", i, n, tt.inline[i])
+				}
+			}
+		})
+	}
+}
+
+func TestColumnInline(t *testing.T) {
+	para := paragraph(textRich("a", nil))
+	tbl := table(false, []string{"a"})
+	tests := []struct {
+		name    string
+		content []notion.Block
+		want    int
+	}{
+		{"empty", nil, 0},
+		{"paragraphs", []notion.Block{para, para}, 2},
+		{"table first", []notion.Block{tbl, para}, 0},
+		{"table later", []notion.Block{para, para, tbl, para}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(columnInline(tt.content)); got != tt.want {
+				t.Errorf("columnInline() = %d blocks, want %d", got, tt.want)
+			}
+		})
+	}
+}
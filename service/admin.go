@@ -0,0 +1,83 @@
+package service
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/permadao/transbot/translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// adminAuth requiring the configured bearer token on admin apis
+func adminAuth(c *gin.Context) {
+	token := viper.GetString("service.admin_token")
+	if token == "" {
+		c.Next()
+		return
+	}
+	auth := c.GetHeader("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+		respondJSONError(c, http.StatusUnauthorized, ErrUnauthorized)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// GetMemoryStats returns translation memory hit/miss counters
+func GetMemoryStats(c *gin.Context) {
+	if transbot.Memory == nil {
+		respondJSONError(c, http.StatusNotFound, ErrMemoryDisabled)
+		return
+	}
+	stats, err := transbot.Memory.Stats()
+	if err != nil {
+		log.WithContext(WithGinContext(c)).Error("memory stats error: ", err.Error())
+		respondJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": stats,
+	})
+}
+
+// PurgeMemory deleting translation memory entries of a language and/or model
+func PurgeMemory(c *gin.Context) {
+	if transbot.Memory == nil {
+		respondJSONError(c, http.StatusNotFound, ErrMemoryDisabled)
+		return
+	}
+	language := c.Query("language")
+	model := c.Query("model")
+	if language == "" && model == "" {
+		respondJSONError(c, http.StatusBadRequest, ErrPurgeFilterNeeded)
+		return
+	}
+	if language != "" {
+		lang, ok := translator.LookupLanguage(language)
+		if !ok {
+			respondJSONError(c, http.StatusBadRequest, ErrUnknownLanguage)
+			return
+		}
+		language = lang.Code
+	}
+
+	deleted, err := transbot.Memory.Purge(language, model)
+	if err != nil {
+		log.WithContext(WithGinContext(c)).Error("purge memory error: ", err.Error())
+		respondJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+	log.WithContext(WithGinContext(c)).Infof("purged %d memory entries, language: %s, model: %s", deleted, language, model)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": gin.H{
+			"deleted": deleted,
+		},
+	})
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// backlinksBucket store bucket of the translations toggles, see backlinkState
+const backlinksBucket = "backlinks"
+
+// backlinksMu serializing the updates of the source pages,
+// the jobs of several languages finish together
+var backlinksMu sync.Mutex
+
+// backlinkState the links to the translations written to a source page
+type backlinkState struct {
+	// ToggleID the translations toggle appended to the source page
+	ToggleID string                  `json:"toggle_id,omitempty"`
+	Blocks   []notionopt.BlockRecord `json:"blocks,omitempty"`
+	// Relation translated page ids last written to the relation property
+	Relation []string `json:"relation,omitempty"`
+}
+
+// translationLink a translated page of a source page
+type translationLink struct {
+	Language string `json:"language"`
+	Mode     string `json:"mode"`
+	PageID   string `json:"page_id"`
+}
+
+// withSourceCallout putting a callout linking to the source page
+// at the top of the translated blocks, if <backlinks.callout> is set
+func withSourceCallout(page *notionopt.NotionPage, blocks []notion.Block) []notion.Block {
+	if !viper.GetBool("backlinks.callout") {
+		return blocks
+	}
+	callout := notionopt.SourceCallout(page.PageInfo.ID, transbot.Backend.Model(), time.Now())
+	return append([]notion.Block{callout}, blocks...)
+}
+
+// updateBacklinks listing all translations of the source page in a toggle
+// appended to the page, and in the relation property of a source row,
+// as enabled by <backlinks.toggle> and <backlinks.relation_property>
+func updateBacklinks(page *notionopt.NotionPage) error {
+	toggle := viper.GetBool("backlinks.toggle")
+	relation := viper.GetString("backlinks.relation_property")
+	if !toggle && relation == "" {
+		return nil
+	}
+
+	backlinksMu.Lock()
+	defer backlinksMu.Unlock()
+
+	links, err := translationLinks(page.PageInfo.ID)
+	if err != nil {
+		return err
+	}
+	key := notionopt.NormalizeID(page.PageInfo.ID)
+	var state backlinkState
+	_, err = db.Get(backlinksBucket, key, &state)
+	if err != nil {
+		return fmt.Errorf("load backlinks error: %w", err)
+	}
+
+	// the writes make transbot the last editor of the source page, which the
+	// watcher ignores, an edit of the author must be recorded first
+	checkAuthorEdit(page.PageInfo.ID)
+	if toggle {
+		err = updateTranslationsToggle(page.PageInfo.ID, links, &state)
+		if err != nil {
+			return err
+		}
+	}
+	if relation != "" {
+		err = updateTranslationsRelation(page, relation, links, &state)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = db.Put(backlinksBucket, key, state)
+	if err != nil {
+		return fmt.Errorf("save backlinks error: %w", err)
+	}
+	return nil
+}
+
+// updateTranslationsToggle syncing the links of the toggle, the toggle is appended
+// to the source page if missing
+func updateTranslationsToggle(sourceId string, links []translationLink, state *backlinkState) error {
+	children := make([]notion.Block, len(links))
+	for i, link := range links {
+		children[i] = notionopt.PageLink(linkLabel(link), link.PageID)
+	}
+
+	var err error
+	if state.ToggleID != "" && transbot.NotionClient.BlockExists(state.ToggleID) {
+		state.Blocks, err = transbot.NotionClient.SyncBlocks(state.ToggleID, children, state.Blocks, nil)
+		if err != nil {
+			return fmt.Errorf("update translations toggle error: %w", err)
+		}
+		return nil
+	}
+
+	title := viper.GetString("backlinks.toggle_title")
+	if title == "" {
+		title = "Translations"
+	}
+	records, err := transbot.NotionClient.SyncBlocks(sourceId, []notion.Block{notionopt.Toggle(title, children)}, nil, nil)
+	if err != nil {
+		return fmt.Errorf("append translations toggle error: %w", err)
+	}
+	state.ToggleID = records[0].ID
+	state.Blocks = records[0].Children
+	return nil
+}
+
+// updateTranslationsRelation setting the relation property of a source row
+// to the translated pages, the row is left untouched if they didn't change
+func updateTranslationsRelation(page *notionopt.NotionPage, property string, links []translationLink, state *backlinkState) error {
+	props, ok := page.PageInfo.Properties.(notion.DatabasePageProperties)
+	if !ok {
+		return nil
+	}
+	if prop, ok := props[property]; !ok || prop.Type != notion.DBPropTypeRelation {
+		return fmt.Errorf("source row has no relation property %s", property)
+	}
+
+	ids := make([]string, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, notionopt.NormalizeID(link.PageID))
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") == strings.Join(state.Relation, ",") {
+		return nil
+	}
+
+	relations := make([]map[string]string, len(ids))
+	for i, id := range ids {
+		relations[i] = map[string]string{"id": id}
+	}
+	_, err := transbot.NotionClient.UpdatePageProperty(page.PageInfo.ID, property, map[string]interface{}{
+		"relation": relations,
+	})
+	if err != nil {
+		return fmt.Errorf("update translations relation error: %w", err)
+	}
+	state.Relation = ids
+	return nil
+}
+
+// translationLinks all recorded translations of the source page, by language and mode
+func translationLinks(sourceId string) ([]translationLink, error) {
+	prefix := notionopt.NormalizeID(sourceId) + "/"
+	var links []translationLink
+	err := db.ForEach(translationsBucket, func(key string, value []byte) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		var link translationLink
+		err := json.Unmarshal(value, &link)
+		if err != nil {
+			return err
+		}
+		links = append(links, link)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load translation records error: %w", err)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Language != links[j].Language {
+			return links[i].Language < links[j].Language
+		}
+		return links[i].Mode < links[j].Mode
+	})
+	return links, nil
+}
+
+// linkLabel the native name of the language, and the mode unless translation
+func linkLabel(link translationLink) string {
+	label := link.Language
+	if language, ok := translator.LookupLanguage(link.Language); ok {
+		label = language.NativeName
+	}
+	if link.Mode != ModeTranslation {
+		label += " (" + link.Mode + ")"
+	}
+	return label
+}
+
+// excludeBacklinks dropping the translations toggle from the blocks of a source page
+func excludeBacklinks(page *notionopt.NotionPage) {
+	var state backlinkState
+	found, err := db.Get(backlinksBucket, notionopt.NormalizeID(page.PageInfo.ID), &state)
+	if err != nil {
+		log.Warn("load backlinks error: ", err.Error())
+		return
+	}
+	if !found || state.ToggleID == "" {
+		return
+	}
+
+	blocks := page.PageContent.Results[:0]
+	for _, block := range page.PageContent.Results {
+		if notionopt.NormalizeID(block.ID()) != notionopt.NormalizeID(state.ToggleID) {
+			blocks = append(blocks, block)
+		}
+	}
+	page.PageContent.Results = blocks
+}
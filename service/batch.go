@@ -0,0 +1,132 @@
+package service
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Batch translation jobs submitted together, like the rows of a database
+type Batch struct {
+	ID         string
+	DatabaseID string
+	Language   string
+	JobIDs     []string
+	CreatedAt  time.Time
+}
+
+// BatchStatus aggregate progress of the jobs of a batch
+type BatchStatus struct {
+	ID               string      `json:"id"`
+	DatabaseID       string      `json:"database_id"`
+	Language         string      `json:"language"`
+	Finished         bool        `json:"finished"`
+	TotalJobs        int         `json:"total_jobs"`
+	QueuedJobs       int         `json:"queued_jobs"`
+	RunningJobs      int         `json:"running_jobs"`
+	DoneJobs         int         `json:"done_jobs"`
+	FailedJobs       int         `json:"failed_jobs"`
+	TotalBlocks      int         `json:"total_blocks"`
+	TranslatedBlocks int         `json:"translated_blocks"`
+	UploadedBlocks   int         `json:"uploaded_blocks"`
+	Jobs             []JobStatus `json:"jobs"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+// SubmitBatch submitting a job for every page, see Submit.
+// The batch and its jobs are registered together before any job starts,
+// so the batch can be looked up as soon as it is returned.
+// @Pararm run, returns the runner of the page job
+func (m *JobManager) SubmitBatch(databaseID, language string, pageIDs []string, run func(pageID string) JobRunner) *Batch {
+	batch := &Batch{
+		ID:         uuid.NewString(),
+		DatabaseID: databaseID,
+		Language:   language,
+		JobIDs:     make([]string, 0, len(pageIDs)),
+		CreatedAt:  time.Now(),
+	}
+	jobs := make([]*Job, len(pageIDs))
+	for i, pageID := range pageIDs {
+		jobs[i] = newJob(pageID, language)
+		batch.JobIDs = append(batch.JobIDs, jobs[i].ID())
+	}
+
+	m.mu.Lock()
+	m.batches[batch.ID] = batch
+	for _, job := range jobs {
+		m.jobs[job.ID()] = job
+	}
+	m.prune()
+	m.mu.Unlock()
+	log.WithField("batch_id", batch.ID).Infof("batch queued, database: %s, language: %s, jobs: %d",
+		databaseID, language, len(pageIDs))
+
+	for i, job := range jobs {
+		m.start(job, run(pageIDs[i]))
+	}
+	return batch
+}
+
+// GetBatch returns the batch status by id, jobs pruned already are left out
+func (m *JobManager) GetBatch(id string) (BatchStatus, bool) {
+	m.mu.RLock()
+	batch, ok := m.batches[id]
+	var jobs []*Job
+	if ok {
+		for _, jobID := range batch.JobIDs {
+			if job, ok := m.jobs[jobID]; ok {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return BatchStatus{}, false
+	}
+
+	status := BatchStatus{
+		ID:         batch.ID,
+		DatabaseID: batch.DatabaseID,
+		Language:   batch.Language,
+		TotalJobs:  len(batch.JobIDs),
+		Jobs:       make([]JobStatus, 0, len(jobs)),
+		CreatedAt:  batch.CreatedAt,
+	}
+	for _, job := range jobs {
+		s := job.Status()
+		switch s.State {
+		case JobQueued:
+			status.QueuedJobs++
+		case JobDone:
+			status.DoneJobs++
+		case JobFailed:
+			status.FailedJobs++
+		default:
+			status.RunningJobs++
+		}
+		status.TotalBlocks += s.TotalBlocks
+		status.TranslatedBlocks += s.TranslatedBlocks
+		status.UploadedBlocks += s.UploadedBlocks
+		status.Jobs = append(status.Jobs, s)
+	}
+	status.Finished = status.QueuedJobs == 0 && status.RunningJobs == 0
+	return status, true
+}
+
+// pruneBatches dropping batches whose jobs are all pruned.
+// Must be called with the lock held.
+func (m *JobManager) pruneBatches() {
+	for id, batch := range m.batches {
+		known := false
+		for _, jobID := range batch.JobIDs {
+			if _, ok := m.jobs[jobID]; ok {
+				known = true
+				break
+			}
+		}
+		if !known {
+			delete(m.batches, id)
+		}
+	}
+}
@@ -3,114 +3,590 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/cryptowizard0/go-notion"
 	"github.com/gin-gonic/gin"
 	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
+// Output modes of the translate api
+const (
+	// ModeTranslation the translated page only
+	ModeTranslation = "translation"
+	// ModeBilingual every source block followed by its translation
+	ModeBilingual = "bilingual"
+	// ModeColumns source and translation side by side
+	ModeColumns = "columns"
+)
+
+// translateOptions options of a page translation
+type translateOptions struct {
+	// Mode output mode, see ModeTranslation
+	Mode string
+	// Destination parent page or database id of the translated page, see resolveDestination
+	Destination string
+	// Publish publishing the translated page to arweave, see publishTranslation
+	Publish bool
+}
+
+// TranslatePage translating a page to one or more languages, separated by commas.
+// The page is fetched once and translated to every language in its own job.
 func TranslatePage(c *gin.Context) {
 	uuid := c.Param("pageuuid")
-	language := c.Param("language")
-	log.Debugf("Get request <translate page> pageuuid: %s , target language: %s", uuid, language)
+	log.Debugf("Get request <translate page> pageuuid: %s , target language: %s", uuid, c.Param("language"))
+	var languages []translator.Language
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(c.Param("language"), ",") {
+		language, ok := translator.LookupLanguage(strings.TrimSpace(name))
+		if !ok {
+			respondJSONError(c, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrUnknownLanguage, name))
+			return
+		}
+		if !seen[language.Code] {
+			seen[language.Code] = true
+			languages = append(languages, language)
+		}
+	}
+	opts := translateOptions{
+		Mode:        c.DefaultQuery("mode", ModeTranslation),
+		Destination: c.Query("destination"),
+	}
+	if !validMode(opts.Mode) {
+		respondJSONError(c, http.StatusBadRequest, ErrUnknownMode)
+		return
+	}
+	var publish *bool
+	if value, ok := c.GetQuery("publish"); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			respondJSONError(c, http.StatusBadRequest, fmt.Errorf("invalid publish: %w", err))
+			return
+		}
+		publish = &parsed
+	}
+	var err error
+	opts.Publish, err = publishOption(publish)
+	if err != nil {
+		respondJSONError(c, http.StatusBadRequest, err)
+		return
+	}
 
-	go translate_segmentation(uuid, language)
+	source := newSourcePage(uuid)
+	jobList := make([]gin.H, len(languages))
+	for i, language := range languages {
+		language := language
+		job := jobs.Submit(uuid, language.Code, func(job *Job) error {
+			return translateSource(job, source, language, opts)
+		})
+		jobList[i] = gin.H{"language": language.Code, "job_id": job.ID()}
+	}
 
+	data := gin.H{"jobs": jobList}
+	if len(jobList) == 1 {
+		data["job_id"] = jobList[0]["job_id"]
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
 		"message": "OK",
+		"data":    data,
 	})
 }
 
-// Divide the text into segments and write each segment
-// into Notion after completing its translation,
-// and write the translated segments separately.
-func translate_segmentation(uuid, language string) {
-	// get notion page
-	pageContent, err := transbot.NotionClient.FetchPage(uuid)
+// databaseRequest body of the database translate api,
+// filter and sorts are passed to the notion database query
+type databaseRequest struct {
+	Language    string                      `json:"language" binding:"required"`
+	Mode        string                      `json:"mode"`
+	Destination string                      `json:"destination"`
+	Publish     *bool                       `json:"publish"`
+	Filter      *notion.DatabaseQueryFilter `json:"filter"`
+	Sorts       []notion.DatabaseQuerySort  `json:"sorts"`
+}
+
+// TranslateDatabase translating all rows of a database matching the query,
+// one job per row, grouped in a batch
+func TranslateDatabase(c *gin.Context) {
+	dbId := c.Param("dbid")
+	var req databaseRequest
+	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		log.WithField("page_id", uuid).Error("fetch page failed: ", err.Error())
+		respondJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+	log.Debugf("Get request <translate database> dbid: %s , target language: %s", dbId, req.Language)
+	language, ok := translator.LookupLanguage(req.Language)
+	if !ok {
+		respondJSONError(c, http.StatusBadRequest, ErrUnknownLanguage)
+		return
+	}
+	opts := translateOptions{Mode: req.Mode, Destination: req.Destination}
+	if opts.Mode == "" {
+		opts.Mode = ModeTranslation
+	}
+	if !validMode(opts.Mode) {
+		respondJSONError(c, http.StatusBadRequest, ErrUnknownMode)
+		return
+	}
+	opts.Publish, err = publishOption(req.Publish)
+	if err != nil {
+		respondJSONError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	// convert string content to struct blocks
-	page, err := transbot.NotionClient.Content2NotionPage(pageContent)
+	pages, err := transbot.NotionClient.QueryDatabase(dbId, &notion.DatabaseQuery{
+		Filter: req.Filter,
+		Sorts:  req.Sorts,
+	})
 	if err != nil {
-		log.Error("convert block error: ", err.Error())
+		respondJSONError(c, http.StatusBadGateway, fmt.Errorf("query database error: %w", err))
 		return
 	}
-	var richTitle *[]notion.RichText
-	// traslate title
-	pageProp, ok := page.PageInfo.Properties.(notion.PageProperties)
+	pageIDs := make([]string, len(pages))
+	for i, page := range pages {
+		pageIDs[i] = page.ID
+	}
+	// no rows, no batch to follow
+	if len(pageIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    http.StatusOK,
+			"message": "OK",
+			"data": gin.H{
+				"job_ids": []string{},
+			},
+		})
+		return
+	}
+
+	batch := jobs.SubmitBatch(dbId, language.Code, pageIDs, func(pageID string) JobRunner {
+		return func(job *Job) error {
+			return translate_segmentation(job, pageID, language, opts)
+		}
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "OK",
+		"data": gin.H{
+			"batch_id": batch.ID,
+			"job_ids":  batch.JobIDs,
+		},
+	})
+}
+
+// GetBatch returns the aggregate progress of a batch of jobs
+func GetBatch(c *gin.Context) {
+	status, ok := jobs.GetBatch(c.Param("id"))
 	if !ok {
-		// try to covert to (notion.DatabasePageProperty)
-		dbProp, ok := page.PageInfo.Properties.(notion.DatabasePageProperties)
-		if !ok {
-			log.Error("get page properties failed!")
-			return
+		respondJSONError(c, http.StatusNotFound, ErrBatchNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": status,
+	})
+}
+
+func validMode(mode string) bool {
+	switch mode {
+	case ModeTranslation, ModeBilingual, ModeColumns:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetJob returns the status of a translation job
+func GetJob(c *gin.Context) {
+	status, ok := jobs.Get(c.Param("id"))
+	if !ok {
+		respondJSONError(c, http.StatusNotFound, ErrJobNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": status,
+	})
+}
+
+// GetLanguages returns the supported target languages
+func GetLanguages(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": translator.Languages(),
+	})
+}
+
+// ListJobs returns all known translation jobs, newest first
+func ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": jobs.List(),
+	})
+}
+
+// Translate the page block by block, then write the translated
+// blocks into a new page under the destination, see resolveDestination.
+// The translated page of a previous run is updated in place instead, see SyncBlocks.
+// Progress is reported on the job.
+func translate_segmentation(job *Job, uuid string, language translator.Language, opts translateOptions) error {
+	return translateSource(job, newSourcePage(uuid), language, opts)
+}
+
+// translateSource translating the shared source page, see translate_segmentation
+func translateSource(job *Job, source *sourcePage, language translator.Language, opts translateOptions) error {
+	// get notion page
+	job.SetState(JobFetching)
+	page, err := source.get()
+	if err != nil {
+		return err
+	}
+	job.SetTotalBlocks(notionopt.CountBlocks(page.PageContent.Results))
+
+	// bilingual pages need the source blocks as well
+	var sources []notion.Block
+	if opts.Mode != ModeTranslation {
+		sources, err = notionopt.CloneBlocks(page.PageContent.Results)
+		if err != nil {
+			return fmt.Errorf("clone blocks error: %w", err)
 		}
-		tmpRichTitle := dbProp["Name"].Title
-		richTitle = &tmpRichTitle
+	}
+
+	// traslate title, or all properties if a database row is translated to a database row
+	job.SetState(JobTranslating)
+	dest, err := resolveDestination(page, language, opts)
+	if err != nil {
+		return err
+	}
+	key := translationKey(page.PageInfo.ID, language.Code, opts.Mode, dest)
+	// a concurrent job of the same translation would create another page
+	unlock := lockTranslation(key)
+	defer unlock()
+	record, err := loadTranslation(key)
+	if err != nil {
+		return err
+	}
+	dbProp, isRow := page.PageInfo.Properties.(notion.DatabasePageProperties)
+	if dest.database() && isRow {
+		err = translateProperties(dbProp, language)
 	} else {
-		richTitle = &pageProp.Title.Title
+		err = translateTitle(page, language)
 	}
-	title := notionopt.GetFullRichtext(*richTitle)
-	tranedTitle, err := transbot.Translate(title, language)
 	if err != nil {
-		log.Error("translate title error: ", err.Error())
-		return
+		return err
 	}
-	notionopt.ReplaceRichtext(richTitle, tranedTitle)
 
-	// create new page
-	newPageuuid, err := transbot.NotionClient.CreateNewPage(page.PageInfo.ID, page)
+	// translate content, nested children are translated with their parent,
+	// blocks unchanged since the previous run reuse its translation
+	var previousSources map[string]BlockTranslation
+	if record != nil && configFlag("translator.incremental", true) {
+		previousSources = record.Sources
+	}
+	translations, err := translateBlocks(job, page.PageContent.Results, language, previousSources)
 	if err != nil {
-		log.Error("create new page error: ", err.Error())
-		return
+		return fmt.Errorf("translate block error: %w", err)
+	}
+	if sources != nil {
+		page.PageContent.Results, err = bilingualBlocks(sources, page.PageContent.Results, opts.Mode)
+		if err != nil {
+			return err
+		}
 	}
 
-	// translate content
-	for _, block := range page.PageContent.Results {
-		toTrans, err := notionopt.GetBlockContent(block)
+	// create new page, or update the translation of a previous run in place
+	job.SetState(JobUploading)
+	updated := record != nil && configFlag("notion.update_in_place", true) &&
+		transbot.NotionClient.PageExists(record.PageID)
+	var previous []notionopt.BlockRecord
+	if updated {
+		dbId := ""
+		if dest.database() {
+			dbId = dest.ID
+		}
+		err = transbot.NotionClient.UpdateTranslatedPage(record.PageID, dbId, page)
 		if err != nil {
-			log.Error("get block content error: ", err.Error())
-			return
+			return fmt.Errorf("update page error: %w", err)
 		}
-		if toTrans != "" {
-			traned, err := transbot.Translate(toTrans, language)
-			if err != nil {
-				log.Error("translate block content error: ", err.Error())
-				return
-			}
+		previous = record.Blocks
+	} else {
+		record = &TranslationRecord{
+			SourceID: page.PageInfo.ID,
+			Language: language.Code,
+			Mode:     opts.Mode,
+		}
+		record.PageID, err = transbot.NotionClient.CreateNewPage(dest.Type, dest.ID, page)
+		if err != nil {
+			return fmt.Errorf("create new page error: %w", err)
+		}
+	}
+	job.SetNewPage(record.PageID, updated)
 
-			err = notionopt.ReplaceBlockContent(block, traned)
-			if err != nil {
-				log.Error("replace block content error: ", err.Error())
-				return
+	// bilingual pages and the source callout add blocks to upload
+	blocks := withSourceCallout(page, page.PageContent.Results)
+	job.SetTotalBlocks(notionopt.CountBlocks(blocks))
+	record.Blocks, err = transbot.NotionClient.SyncBlocks(record.PageID, blocks, previous, job.AddUploaded)
+	record.Sources = translations
+	if err != nil {
+		// the blocks uploaded so far are on the page, the next run syncs them
+		// instead of appending them again
+		saveErr := saveTranslation(key, *record)
+		if saveErr != nil {
+			log.WithField("page", record.PageID).Error(saveErr.Error())
+		}
+		return fmt.Errorf("append child block error: %w", err)
+	}
+	err = saveTranslation(key, *record)
+	if err != nil {
+		return err
+	}
+
+	// publish to arweave, the publication is recorded along with the translation
+	if opts.Publish {
+		job.SetState(JobPublishing)
+		err = publishTranslation(job, page, blocks, language, record)
+		if err != nil {
+			return err
+		}
+		err = saveTranslation(key, *record)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the source page links to its translations
+	err = updateBacklinks(page)
+	if err != nil {
+		log.WithField("page", page.PageInfo.ID).Warn("update backlinks error: ", err.Error())
+	}
+	return nil
+}
+
+// bilingualBlocks merging the source blocks with their translations,
+// translated text is styled by the bilingual config section
+func bilingualBlocks(sources, translations []notion.Block, mode string) ([]notion.Block, error) {
+	layout := notionopt.BilingualInterleaved
+	if mode == ModeColumns {
+		layout = notionopt.BilingualColumns
+	}
+	style := notionopt.BilingualStyle{
+		Color: notion.Color(viper.GetString("bilingual.color")),
+		Quote: viper.GetBool("bilingual.quote"),
+	}
+	blocks, err := notionopt.Bilingual(sources, translations, layout, style)
+	if err != nil {
+		return nil, fmt.Errorf("merge bilingual blocks error: %w", err)
+	}
+	return blocks, nil
+}
+
+// translateTitle translating the page title
+func translateTitle(page *notionopt.NotionPage, language translator.Language) error {
+	richTitle, err := transbot.NotionClient.PageTitle(page)
+	if err != nil {
+		return fmt.Errorf("get page title error: %w", err)
+	}
+	title := notionopt.GetFullRichtext(richTitle)
+	if strings.TrimSpace(title) == "" {
+		return nil
+	}
+	tranedTitle, err := transbot.Translate(title, language)
+	if err != nil {
+		return fmt.Errorf("translate title error: %w", err)
+	}
+	notionopt.ReplaceRichtext(&richTitle, tranedTitle)
+	return transbot.NotionClient.SetPageTitle(page, richTitle)
+}
+
+// translateBlocks translating the blocks and all of their nested children.
+// Blocks with the fingerprint of a previous translation reuse it.
+// @Pararm previous, translations of a previous run by block id, may be nil
+// @Return translations of the blocks, for the next run
+func translateBlocks(job *Job, blocks []notion.Block, language translator.Language, previous map[string]BlockTranslation) (map[string]BlockTranslation, error) {
+	segments := notionopt.CollectSegments(blocks, viper.GetBool("translator.code_comments"))
+	if job != nil {
+		// blocks without text are done already
+		job.AddTranslated(notionopt.CountBlocks(blocks) - countSegmentBlocks(segments))
+	}
+
+	budget := 1500
+	if viper.IsSet("translator.batch_tokens") {
+		budget = viper.GetInt("translator.batch_tokens")
+	}
+	limit := 3000
+	if viper.IsSet("translator.chunk_chars") {
+		limit = viper.GetInt("translator.chunk_chars")
+	}
+
+	// fingerprints are taken before any text is replaced
+	fingerprints := make([]notionopt.Fingerprint, len(segments))
+	for i, segment := range segments {
+		if i > 0 && segments[i-1].BlockIndex == segment.BlockIndex {
+			fingerprints[i] = fingerprints[i-1]
+		} else {
+			fingerprints[i] = notionopt.BlockFingerprint(segment.Block)
+		}
+	}
+	traned := make([]string, len(segments))
+	reused := reusedTranslations(segments, fingerprints, previous, traned)
+	for i, segment := range segments {
+		if !reused[i] {
+			continue
+		}
+		err := segment.Apply(traned[i])
+		if err != nil {
+			return nil, fmt.Errorf("replace block content error: %w", err)
+		}
+		if job != nil && lastBlockSegment(segments, i) {
+			job.AddTranslated(1)
+			job.AddReused(1)
+		}
+	}
+
+	sources := make([][]string, len(segments))
+	chunkResults := make([][]string, len(segments))
+	var chunks []segmentChunk
+	for i, segment := range segments {
+		if reused[i] {
+			continue
+		}
+		sources[i] = segment.Chunks(limit)
+		for _, source := range sources[i] {
+			chunks = append(chunks, segmentChunk{segment: i, source: source})
+		}
+	}
+
+	for _, batch := range batchChunks(chunks, budget) {
+		contents := make([]string, len(batch))
+		for i, chunk := range batch {
+			contents[i] = chunk.source
+		}
+		results, err := transbot.TranslateBatch(contents, language)
+		if err != nil {
+			return nil, fmt.Errorf("translate block content error: %w", err)
+		}
+
+		for i, chunk := range batch {
+			chunkResults[chunk.segment] = append(chunkResults[chunk.segment], results[i])
+			if len(chunkResults[chunk.segment]) < len(sources[chunk.segment]) {
+				continue
 			}
 
-			err = transbot.NotionClient.AppendBlockChildren(newPageuuid, block)
+			// all chunks of the segment are translated
+			segment := segments[chunk.segment]
+			source := segment.Text()
+			traned[chunk.segment] = notionopt.JoinChunks(sources[chunk.segment], chunkResults[chunk.segment])
+			err = segment.Apply(traned[chunk.segment])
 			if err != nil {
-				log.Error("append child block error: ", err.Error())
-				return
+				return nil, fmt.Errorf("replace block content error: %w", err)
 			}
-		} else { // contentless block, like image
-			err = transbot.NotionClient.AppendBlockChildren(newPageuuid, block)
-			if err != nil {
-				log.Error("append child block error: ", err.Error())
-				return
+			if job == nil {
+				continue
 			}
+			if lastBlockSegment(segments, chunk.segment) {
+				job.AddTranslated(1)
+			}
+			missing := transbot.CheckGlossary(source, segment.Text(), language)
+			if len(missing) > 0 {
+				job.FlagGlossary(segment.Block.ID(), missing)
+			}
+		}
+	}
+
+	translations := make(map[string]BlockTranslation)
+	for i, fingerprint := range fingerprints {
+		if fingerprint.ID == "" {
+			continue
+		}
+		translation := translations[fingerprint.ID]
+		translation.Fingerprint = fingerprint
+		translation.Segments = append(translation.Segments, traned[i])
+		translations[fingerprint.ID] = translation
+	}
+	return translations, nil
+}
+
+// reusedTranslations finding the segments of blocks whose fingerprint is unchanged,
+// their previous translation is copied to traned
+// @Return for every segment whether it is reused
+func reusedTranslations(segments []notionopt.Segment, fingerprints []notionopt.Fingerprint, previous map[string]BlockTranslation, traned []string) []bool {
+	reused := make([]bool, len(segments))
+	for start := 0; start < len(segments); {
+		end := start + 1
+		for !lastBlockSegment(segments, end-1) {
+			end++
+		}
+		fingerprint := fingerprints[start]
+		translation, ok := previous[fingerprint.ID]
+		if ok && fingerprint.ID != "" && translation.Equal(fingerprint) && len(translation.Segments) == end-start {
+			copy(traned[start:end], translation.Segments)
+			for i := start; i < end; i++ {
+				reused[i] = true
+			}
+		}
+		start = end
+	}
+	return reused
+}
+
+// lastBlockSegment returns true if the segment is the last one of its block
+func lastBlockSegment(segments []notionopt.Segment, i int) bool {
+	return i+1 == len(segments) || segments[i+1].BlockIndex != segments[i].BlockIndex
+}
+
+// segmentChunk a chunk of the source of a segment
+type segmentChunk struct {
+	segment int
+	source  string
+}
+
+// batchChunks grouping consecutive chunks up to the token budget,
+// a budget <= 0 disables batching
+func batchChunks(chunks []segmentChunk, budget int) [][]segmentChunk {
+	var batches [][]segmentChunk
+	var batch []segmentChunk
+	tokens := 0
+	for _, chunk := range chunks {
+		size := translator.EstimateTokens(chunk.source)
+		if len(batch) > 0 && (budget <= 0 || tokens+size > budget) {
+			batches = append(batches, batch)
+			batch, tokens = nil, 0
 		}
+		batch = append(batch, chunk)
+		tokens += size
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
 	}
+	return batches
+}
+
+// Number of distinct blocks with segments
+func countSegmentBlocks(segments []notionopt.Segment) int {
+	count := 0
+	for i, segment := range segments {
+		if i == 0 || segments[i-1].BlockIndex != segment.BlockIndex {
+			count++
+		}
+	}
+	return count
 }
 
 // Concurrent translation, aggregate the results after translation,
 // and generate the complete page in one go.
 func translate_concurrent(c *gin.Context) {
 	uuid := c.Param("pageuuid")
-	language := c.Param("language")
-	log.Debugf("Get request <translate page> pageuuid: %s , target language: %s", uuid, language)
+	log.Debugf("Get request <translate page> pageuuid: %s , target language: %s", uuid, c.Param("language"))
+	language, ok := translator.LookupLanguage(c.Param("language"))
+	if !ok {
+		respondJSONError(c, http.StatusBadRequest, ErrUnknownLanguage)
+		return
+	}
 
 	// get notion page
 	pageContent, err := transbot.NotionClient.FetchPage(uuid)
@@ -129,34 +605,16 @@ func translate_concurrent(c *gin.Context) {
 	}
 
 	// translate content
-	for _, block := range page.PageContent.Results {
-		toTrans, err := notionopt.GetBlockContent(block)
-		if err != nil {
-			log.WithContext(WithGinContext(c)).Error("get block content error: ", err.Error())
-			respondJSONError(c, http.StatusBadRequest, err)
-			return
-		}
-		if toTrans != "" {
-			traned, err := transbot.Translate(toTrans, language)
-			if err != nil {
-				log.WithContext(WithGinContext(c)).Error("translate error: ", err.Error())
-				respondJSONError(c, http.StatusBadRequest, err)
-				return
-			}
-
-			err = notionopt.ReplaceBlockContent(block, traned)
-			if err != nil {
-				log.WithContext(WithGinContext(c)).Error("replace block content error: ", err.Error())
-				respondJSONError(c, http.StatusBadRequest, err)
-				return
-			}
-		}
+	_, err = translateBlocks(nil, page.PageContent.Results, language, nil)
+	if err != nil {
+		log.WithContext(WithGinContext(c)).Error("translate error: ", err.Error())
+		respondJSONError(c, http.StatusBadRequest, err)
+		return
 	}
 
 	// upload new page
 	newPageuuid, err := transbot.NotionClient.UploadPage(page.PageInfo.ID, page)
 	if err != nil {
-		fmt.Println("UploadPage error: ", err)
 		log.WithContext(WithGinContext(c)).Error("upload page error: ", err.Error())
 		respondJSONError(c, http.StatusBadRequest, err)
 		return
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
+	"github.com/spf13/viper"
+)
+
+var edited = time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+func paragraphBlock(id, text string) notion.Block {
+	return notion.BlockDTO{
+		BaseBlock: notion.BaseBlock{BID: id, BLastEditedTime: edited},
+		Type:      notion.BlockTypeParagraph,
+		Paragraph: &notion.ParagraphBlock{RichText: []notion.RichText{textRun(text)}},
+	}
+}
+
+func rowBlock(id string, cells ...string) notion.Block {
+	row := make([][]notion.RichText, len(cells))
+	for i, cell := range cells {
+		row[i] = []notion.RichText{textRun(cell)}
+	}
+	return notion.BlockDTO{
+		BaseBlock: notion.BaseBlock{BID: id, BLastEditedTime: edited},
+		Type:      notion.BlockTypeTableRow,
+		TableRow:  &notion.TableRowBlock{Cells: row},
+	}
+}
+
+func textRun(text string) notion.RichText {
+	return notion.RichText{Type: notion.RichTextTypeText, Text: &notion.Text{Content: text}, PlainText: text}
+}
+
+func blockText(block notion.Block) string {
+	dto := block.(notion.BlockDTO)
+	var text string
+	for _, rt := range dto.Paragraph.RichText {
+		text += rt.Text.Content
+	}
+	return text
+}
+
+func TestReusedTranslations(t *testing.T) {
+	blocks := []notion.Block{
+		paragraphBlock("a", "Hello"),
+		rowBlock("r", "one", "two"),
+		paragraphBlock("", "no id"),
+	}
+	segments := notionopt.CollectSegments(blocks, false)
+	fingerprints := []notionopt.Fingerprint{
+		notionopt.BlockFingerprint(blocks[0]),
+		notionopt.BlockFingerprint(blocks[1]),
+		notionopt.BlockFingerprint(blocks[1]),
+		notionopt.BlockFingerprint(blocks[2]),
+	}
+	if len(segments) != len(fingerprints) {
+		t.Fatalf("got %d segments, want %d", len(segments), len(fingerprints))
+	}
+	changed := fingerprints[0]
+	changed.Hash = "other"
+	later := fingerprints[0]
+	later.LastEditedTime = edited.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		previous map[string]BlockTranslation
+		want     []bool
+		traned   []string
+	}{
+		{"no previous", nil, []bool{false, false, false, false}, []string{"", "", "", ""}},
+		{
+			"unchanged",
+			map[string]BlockTranslation{
+				"a": {Fingerprint: fingerprints[0], Segments: []string{"Bonjour"}},
+				"r": {Fingerprint: fingerprints[1], Segments: []string{"un", "deux"}},
+			},
+			[]bool{true, true, true, false},
+			[]string{"Bonjour", "un", "deux", ""},
+		},
+		{
+			"changed content",
+			map[string]BlockTranslation{"a": {Fingerprint: changed, Segments: []string{"Bonjour"}}},
+			[]bool{false, false, false, false},
+			[]string{"", "", "", ""},
+		},
+		{
+			"edited later",
+			map[string]BlockTranslation{"a": {Fingerprint: later, Segments: []string{"Bonjour"}}},
+			[]bool{false, false, false, false},
+			[]string{"", "", "", ""},
+		},
+		{
+			"other number of segments",
+			map[string]BlockTranslation{"r": {Fingerprint: fingerprints[1], Segments: []string{"un"}}},
+			[]bool{false, false, false, false},
+			[]string{"", "", "", ""},
+		},
+		{
+			"blocks without id",
+			map[string]BlockTranslation{"": {Fingerprint: fingerprints[3], Segments: []string{"sans id"}}},
+			[]bool{false, false, false, false},
+			[]string{"", "", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traned := make([]string, len(segments))
+			got := reusedTranslations(segments, fingerprints, tt.previous, traned)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reused = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(traned, tt.traned) {
+				t.Errorf("traned = %q, want %q", traned, tt.traned)
+			}
+		})
+	}
+}
+
+func TestTranslateBlocks(t *testing.T) {
+	viper.Set("translator.backend", "mock")
+	defer viper.Set("translator.backend", nil)
+	var err error
+	transbot, err = translator.CreateTranslator("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { transbot = nil }()
+	french, _ := translator.LookupLanguage("fr")
+
+	source := []notion.Block{paragraphBlock("a", "Hello"), paragraphBlock("b", "World")}
+	previous := map[string]BlockTranslation{
+		"a": {Fingerprint: notionopt.BlockFingerprint(source[0]), Segments: []string{"Bonjour"}},
+		"b": {Fingerprint: notionopt.Fingerprint{ID: "b", LastEditedTime: edited, Hash: "other"}, Segments: []string{"Monde"}},
+	}
+
+	translations, err := translateBlocks(nil, source, french, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blockText(source[0]); got != "Bonjour" {
+		t.Errorf("reused block = %q, want the previous translation", got)
+	}
+	if got := blockText(source[1]); got != "[fr] World" {
+		t.Errorf("changed block = %q, want a new translation", got)
+	}
+	if got := translations["b"].Segments; !reflect.DeepEqual(got, []string{"[fr] World"}) {
+		t.Errorf("recorded segments = %q", got)
+	}
+	if got := translations["a"].Fingerprint; !got.Equal(previous["a"].Fingerprint) {
+		t.Errorf("recorded fingerprint = %+v, want the source fingerprint", got)
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
+	"github.com/spf13/viper"
+)
+
+// destination the parent page or database the translated page is created in
+type destination struct {
+	Type notion.ParentType
+	ID   string
+}
+
+// database returns true if the translation is a row of the database
+func (d destination) database() bool {
+	return d.Type == notion.ParentTypeDatabase
+}
+
+// resolveDestination returns where the translation of the page is created: the destination
+// of the request, the destination of the language in <destinations>, the target database
+// of a row (see rowTarget), or the source page itself
+func resolveDestination(page *notionopt.NotionPage, language translator.Language, opts translateOptions) (destination, error) {
+	id := opts.Destination
+	if id == "" {
+		id = languageDestination(language)
+	}
+	if id != "" {
+		parentType, err := transbot.NotionClient.ParentType(id)
+		if err != nil {
+			return destination{}, fmt.Errorf("resolve destination error: %w", err)
+		}
+		return destination{Type: parentType, ID: id}, nil
+	}
+
+	if dbId, ok := rowTarget(page); ok {
+		return destination{Type: notion.ParentTypeDatabase, ID: dbId}, nil
+	}
+	return destination{Type: notion.ParentTypePage, ID: page.PageInfo.ID}, nil
+}
+
+// languageDestination the destination configured for the language, empty if none.
+// Languages are given by code or english name.
+func languageDestination(language translator.Language) string {
+	for name, id := range viper.GetStringMapString("destinations") {
+		lang, ok := translator.LookupLanguage(name)
+		if ok && lang.Code == language.Code {
+			return id
+		}
+	}
+	return ""
+}
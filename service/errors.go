@@ -1,10 +1,23 @@
 package service
 
 import (
+	"errors"
+
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	ErrBatchNotFound      = errors.New("batch not found")
+	ErrJobNotFound        = errors.New("job not found")
+	ErrMemoryDisabled     = errors.New("translation memory is disabled")
+	ErrPublishingDisabled = errors.New("arweave publishing is disabled")
+	ErrPurgeFilterNeeded  = errors.New("language or model is required")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrUnknownLanguage    = errors.New("unknown language")
+	ErrUnknownMode        = errors.New("unknown output mode")
+)
+
 func respondJSONError(ctx *gin.Context, code int, err error) {
 	ctx.JSON(code, gin.H{
 		"requestID": requestid.Get(ctx),
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/permadao/transbot/arweave"
+	log "github.com/sirupsen/logrus"
+)
+
+type JobState string
+
+const (
+	JobQueued      JobState = "queued"
+	JobFetching    JobState = "fetching"
+	JobTranslating JobState = "translating"
+	JobUploading   JobState = "uploading"
+	JobPublishing  JobState = "publishing"
+	JobDone        JobState = "done"
+	JobFailed      JobState = "failed"
+)
+
+// GlossaryFlag a translated block missing mandated glossary terms
+type GlossaryFlag struct {
+	BlockID string   `json:"block_id"`
+	Missing []string `json:"missing"`
+}
+
+// JobStatus is the snapshot of a job returned by the jobs api
+type JobStatus struct {
+	ID        string   `json:"id"`
+	PageID    string   `json:"page_id"`
+	Language  string   `json:"language"`
+	State     JobState `json:"state"`
+	NewPageID string   `json:"new_page_id,omitempty"`
+	// Updated the new page is a previous translation updated in place
+	Updated bool `json:"updated,omitempty"`
+	// TotalBlocks blocks of the source page, then of the page to upload once
+	// translated, which has the source blocks as well in bilingual modes
+	TotalBlocks      int `json:"total_blocks"`
+	TranslatedBlocks int `json:"translated_blocks"`
+	// ReusedBlocks translated blocks unchanged since the previous run, not translated again
+	ReusedBlocks   int            `json:"reused_blocks,omitempty"`
+	UploadedBlocks int            `json:"uploaded_blocks"`
+	GlossaryFlags  []GlossaryFlag `json:"glossary_flags,omitempty"`
+	// Arweave the bundle the translated page was published in
+	Arweave   *arweave.Publication `json:"arweave,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// Job a single page translation, safe for concurrent use
+type Job struct {
+	mu     sync.Mutex
+	status JobStatus
+}
+
+func (j *Job) ID() string {
+	return j.status.ID
+}
+
+// Status returns a snapshot of the job
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+func (j *Job) update(fn func(s *JobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+	j.status.UpdatedAt = time.Now()
+}
+
+func (j *Job) SetState(state JobState) {
+	j.update(func(s *JobStatus) { s.State = state })
+	log.WithField("job_id", j.ID()).Info("job state: ", state)
+}
+
+func (j *Job) SetTotalBlocks(total int) {
+	j.update(func(s *JobStatus) { s.TotalBlocks = total })
+}
+
+func (j *Job) SetNewPage(pageID string, updated bool) {
+	j.update(func(s *JobStatus) {
+		s.NewPageID = pageID
+		s.Updated = updated
+	})
+}
+
+func (j *Job) AddTranslated(count int) {
+	j.update(func(s *JobStatus) { s.TranslatedBlocks += count })
+}
+
+func (j *Job) AddReused(count int) {
+	j.update(func(s *JobStatus) { s.ReusedBlocks += count })
+}
+
+func (j *Job) AddUploaded(count int) {
+	j.update(func(s *JobStatus) { s.UploadedBlocks += count })
+}
+
+func (j *Job) SetPublication(publication arweave.Publication) {
+	j.update(func(s *JobStatus) { s.Arweave = &publication })
+}
+
+// FlagGlossary recording a block missing mandated glossary terms
+func (j *Job) FlagGlossary(blockID string, missing []string) {
+	j.update(func(s *JobStatus) {
+		s.GlossaryFlags = append(s.GlossaryFlags, GlossaryFlag{BlockID: blockID, Missing: missing})
+	})
+	log.WithField("job_id", j.ID()).Warnf("block %s misses glossary terms: %v", blockID, missing)
+}
+
+// Fail marking the job as failed with the error
+func (j *Job) Fail(err error) {
+	j.update(func(s *JobStatus) {
+		s.State = JobFailed
+		s.Error = err.Error()
+	})
+	log.WithField("job_id", j.ID()).Error("job failed: ", err.Error())
+}
+
+func (j *Job) finished() bool {
+	state := j.Status().State
+	return state == JobDone || state == JobFailed
+}
+
+// JobRunner runs a job, the job is marked as failed if an error is returned
+type JobRunner func(job *Job) error
+
+// JobManager tracking translation jobs in memory.
+// At most `workers` jobs are running at the same time, others are queued.
+type JobManager struct {
+	mu      sync.RWMutex
+	jobs    map[string]*Job
+	batches map[string]*Batch
+	maxJobs int
+	workers chan struct{}
+}
+
+func NewJobManager(workers, maxJobs int) *JobManager {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &JobManager{
+		jobs:    make(map[string]*Job),
+		batches: make(map[string]*Batch),
+		maxJobs: maxJobs,
+		workers: make(chan struct{}, workers),
+	}
+}
+
+// Submit creating a queued job and running it in the background
+func (m *JobManager) Submit(pageID, language string, run JobRunner) *Job {
+	job := newJob(pageID, language)
+
+	m.mu.Lock()
+	m.jobs[job.ID()] = job
+	m.prune()
+	m.mu.Unlock()
+
+	m.start(job, run)
+	return job
+}
+
+func newJob(pageID, language string) *Job {
+	now := time.Now()
+	return &Job{
+		status: JobStatus{
+			ID:        uuid.NewString(),
+			PageID:    pageID,
+			Language:  language,
+			State:     JobQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+}
+
+// start running a registered job in the background, once a worker is free
+func (m *JobManager) start(job *Job, run JobRunner) {
+	log.WithField("job_id", job.ID()).Infof("job queued, page: %s, language: %s", job.status.PageID, job.status.Language)
+
+	go func() {
+		m.workers <- struct{}{}
+		defer func() { <-m.workers }()
+
+		err := run(job)
+		if err != nil {
+			job.Fail(err)
+			return
+		}
+		job.SetState(JobDone)
+	}()
+}
+
+// Get returns the job status by id
+func (m *JobManager) Get(id string) (JobStatus, bool) {
+	m.mu.RLock()
+	job, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return JobStatus{}, false
+	}
+	return job.Status(), true
+}
+
+// List returns all known jobs, newest first
+func (m *JobManager) List() []JobStatus {
+	m.mu.RLock()
+	list := make([]JobStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, job.Status())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// prune dropping the oldest finished jobs when exceeding maxJobs.
+// Must be called with the lock held.
+func (m *JobManager) prune() {
+	if m.maxJobs <= 0 || len(m.jobs) <= m.maxJobs {
+		return
+	}
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.finished() {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Status().CreatedAt.Before(finished[j].Status().CreatedAt)
+	})
+	for _, job := range finished {
+		if len(m.jobs) <= m.maxJobs {
+			break
+		}
+		delete(m.jobs, job.ID())
+	}
+	m.pruneBatches()
+}
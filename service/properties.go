@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// OptionMapping the translated name of a select or multi-select option
+type OptionMapping struct {
+	// Property the property name, empty for all properties
+	Property string `mapstructure:"property"`
+	Option   string `mapstructure:"option"`
+	// Language the target language, code or english name
+	Language string `mapstructure:"language"`
+	Target   string `mapstructure:"target"`
+}
+
+// rowTarget returns the database the translation of a database row is created in,
+// if <database.output> is "row". The target database is mapped by <database.targets>,
+// the source database by default.
+func rowTarget(page *notionopt.NotionPage) (dbId string, ok bool) {
+	if viper.GetString("database.output") != "row" ||
+		page.PageInfo.Parent.Type != notion.ParentTypeDatabase {
+		return "", false
+	}
+
+	source := page.PageInfo.Parent.DatabaseID
+	for from, to := range viper.GetStringMapString("database.targets") {
+		if notionopt.NormalizeID(from) == notionopt.NormalizeID(source) {
+			return to, true
+		}
+	}
+	return source, true
+}
+
+// translateProperties translating the title and rich text properties of a database row,
+// select and multi-select options are renamed by <database.options>.
+// Other properties are kept unchanged.
+func translateProperties(props notion.DatabasePageProperties, language translator.Language) error {
+	var names []string
+	for name, prop := range props {
+		richtext := propertyRichtext(&prop)
+		if richtext != nil && strings.TrimSpace(notionopt.GetFullRichtext(*richtext)) != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		sources := make([]string, len(names))
+		for i, name := range names {
+			prop := props[name]
+			sources[i] = notionopt.EncodeRichtext(*propertyRichtext(&prop))
+		}
+		traned, err := transbot.TranslateBatch(sources, language)
+		if err != nil {
+			return fmt.Errorf("translate properties error: %w", err)
+		}
+		for i, name := range names {
+			prop := props[name]
+			err = notionopt.ApplyTranslation(propertyRichtext(&prop), traned[i])
+			if err != nil {
+				return fmt.Errorf("replace property %s error: %w", name, err)
+			}
+			props[name] = prop
+		}
+	}
+
+	var mappings []OptionMapping
+	err := viper.UnmarshalKey("database.options", &mappings)
+	if err != nil {
+		return fmt.Errorf("parse option mapping error: %w", err)
+	}
+	for name, prop := range props {
+		switch prop.Type {
+		case notion.DBPropTypeSelect:
+			if prop.Select == nil {
+				continue
+			}
+			prop.Select = &notion.SelectOptions{Name: mapOption(mappings, name, prop.Select.Name, language)}
+		case notion.DBPropTypeMultiSelect:
+			options := make([]notion.SelectOptions, len(prop.MultiSelect))
+			for i, option := range prop.MultiSelect {
+				options[i] = notion.SelectOptions{Name: mapOption(mappings, name, option.Name, language)}
+			}
+			prop.MultiSelect = options
+		default:
+			continue
+		}
+		props[name] = prop
+	}
+	return nil
+}
+
+func propertyRichtext(prop *notion.DatabasePageProperty) *[]notion.RichText {
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		return &prop.Title
+	case notion.DBPropTypeRichText:
+		return &prop.RichText
+	default:
+		return nil
+	}
+}
+
+// mapOption returns the mapped option name, or the name itself if not mapped
+func mapOption(mappings []OptionMapping, property, option string, language translator.Language) string {
+	for _, m := range mappings {
+		if m.Property != "" && m.Property != property {
+			continue
+		}
+		if !strings.EqualFold(m.Option, option) {
+			continue
+		}
+		lang, ok := translator.LookupLanguage(m.Language)
+		if !ok {
+			log.Warnf("option mapping %s: unknown language %s", m.Option, m.Language)
+			continue
+		}
+		if lang.Code == language.Code {
+			return m.Target
+		}
+	}
+	return option
+}
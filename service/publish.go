@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/arweave"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
+	"github.com/spf13/viper"
+)
+
+// publisher is nil unless <arweave.enabled> is set
+var publisher *arweave.Publisher
+
+// publishOption whether a translation is published to arweave,
+// <arweave.publish> unless requested explicitly
+func publishOption(requested *bool) (bool, error) {
+	publish := viper.GetBool("arweave.publish")
+	if requested != nil {
+		publish = *requested
+	}
+	if publish && publisher == nil {
+		return false, ErrPublishingDisabled
+	}
+	return publish, nil
+}
+
+// publishTranslation publishing the translated page to arweave,
+// the page is not published again if unchanged since its last publication
+// @Pararm blocks, the blocks of the translated page
+func publishTranslation(job *Job, page *notionopt.NotionPage, blocks []notion.Block, language translator.Language, record *TranslationRecord) error {
+	richTitle, err := transbot.NotionClient.PageTitle(page)
+	if err != nil {
+		return fmt.Errorf("get page title error: %w", err)
+	}
+	title := notionopt.GetFullRichtext(richTitle)
+
+	doc := arweave.Document{
+		SourceID: record.SourceID,
+		PageID:   record.PageID,
+		Language: language.Code,
+		Mode:     record.Mode,
+		Title:    title,
+		Blocks:   blocks,
+		HTML:     notionopt.RenderHTML(title, language.Code, blocks),
+		Markdown: notionopt.RenderMarkdown(title, blocks),
+	}
+
+	if record.Publication != nil && record.Publication.Hash == arweave.Hash(doc) {
+		job.SetPublication(*record.Publication)
+		return nil
+	}
+	publication, err := publisher.Publish(doc)
+	if err != nil {
+		return fmt.Errorf("publish to arweave error: %w", err)
+	}
+	record.Publication = publication
+	job.SetPublication(*publication)
+	return nil
+}
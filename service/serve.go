@@ -2,20 +2,53 @@ package service
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/permadao/transbot/arweave"
+	"github.com/permadao/transbot/assets"
+	"github.com/permadao/transbot/store"
 	"github.com/permadao/transbot/translator"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-var transbot *translator.Translator
+var (
+	transbot *translator.Translator
+	jobs     *JobManager
+	db       *store.Store
+)
 
 func StartServe() {
 	log.Info("Starting server...")
-	openai_key := viper.GetString("openai.api_key")
+	var err error
+	storePath := viper.GetString("store.path")
+	if storePath == "" {
+		storePath = "./transbot.db"
+	}
+	db, err = store.Open(storePath)
+	if err != nil {
+		log.Fatal("open store error: ", err.Error())
+	}
 	notion_auth := viper.GetString("notion.api_auth")
-	transbot = translator.CreateTranslator(openai_key, notion_auth)
+	transbot, err = translator.CreateTranslator(notion_auth, db)
+	if err != nil {
+		log.Fatal("create translator error: ", err.Error())
+	}
+	if viper.GetBool("arweave.enabled") {
+		publisher, err = arweave.NewPublisher(viper.GetString("arweave.wallet"), viper.GetString("arweave.gateway"))
+		if err != nil {
+			log.Fatal("create arweave publisher error: ", err.Error())
+		}
+		log.Info("arweave publishing enabled, wallet: ", publisher.Address())
+	}
+	jobs = NewJobManager(viper.GetInt("service.workers"), viper.GetInt("service.max_jobs"))
+	go handleShutdown()
+	if viper.GetBool("watcher.enabled") {
+		StartWatcher()
+	}
 
 	// ruter
 	router := gin.Default()
@@ -31,9 +64,23 @@ func StartServe() {
 		c.Next()
 	})
 
+	// re-hosted images and files
+	if local, ok := transbot.NotionClient.AssetStore().(*assets.LocalStore); ok {
+		router.Static(assets.LocalRoute, local.Dir)
+	}
+
 	// path
 	group := router.Group("/v1/")
 	group.GET("/translate/:pageuuid/:language", TranslatePage)
+	group.POST("/translate/database/:dbid", TranslateDatabase)
+	group.GET("/languages", GetLanguages)
+	group.GET("/jobs", ListJobs)
+	group.GET("/jobs/:id", GetJob)
+	group.GET("/batches/:id", GetBatch)
+
+	admin := group.Group("/admin", adminAuth)
+	admin.GET("/memory", GetMemoryStats)
+	admin.DELETE("/memory", PurgeMemory)
 
 	port := fmt.Sprintf(":%s", viper.GetString("service.port"))
 	if viper.GetBool("service.tls") {
@@ -51,3 +98,16 @@ func StartServe() {
 	}
 
 }
+
+// handleShutdown stopping pending translations and closing the store on SIGINT or SIGTERM
+func handleShutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Info("shutting down on ", <-sig)
+	transbot.Close()
+	err := db.Close()
+	if err != nil {
+		log.Error("close store error: ", err.Error())
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/permadao/transbot/notionopt"
+)
+
+// sourcePage a source page fetched and parsed once,
+// shared by the jobs translating it to several languages
+type sourcePage struct {
+	uuid string
+	once sync.Once
+	page *notionopt.NotionPage
+	err  error
+}
+
+func newSourcePage(uuid string) *sourcePage {
+	return &sourcePage{uuid: uuid}
+}
+
+// get returns a copy of the page to be translated,
+// the first caller fetches it and the others wait
+func (s *sourcePage) get() (*notionopt.NotionPage, error) {
+	s.once.Do(func() {
+		s.page, s.err = fetchSource(s.uuid)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+	page, err := notionopt.ClonePage(s.page)
+	if err != nil {
+		return nil, fmt.Errorf("clone page error: %w", err)
+	}
+	return page, nil
+}
+
+// fetchSource fetching the page with all its blocks from notion
+func fetchSource(uuid string) (*notionopt.NotionPage, error) {
+	pageContent, err := transbot.NotionClient.FetchPage(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("fetch page failed: %w", err)
+	}
+
+	// convert string content to struct blocks
+	page, err := transbot.NotionClient.Content2NotionPage(pageContent)
+	if err != nil {
+		return nil, fmt.Errorf("convert block error: %w", err)
+	}
+	// the translations toggle is not part of the content
+	excludeBacklinks(page)
+	return page, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/permadao/transbot/arweave"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/spf13/viper"
+)
+
+// translationsBucket store bucket of the translated pages, see TranslationRecord
+const translationsBucket = "translations"
+
+// TranslationRecord a translated page, updated in place
+// when the source page is translated again
+type TranslationRecord struct {
+	SourceID string `json:"source_id"`
+	Language string `json:"language"`
+	Mode     string `json:"mode"`
+	// PageID the translated page or database row
+	PageID string                  `json:"page_id"`
+	Blocks []notionopt.BlockRecord `json:"blocks"`
+	// Sources translations of the source blocks, by block id
+	Sources map[string]BlockTranslation `json:"sources,omitempty"`
+	// Publication the last arweave publication of the translated page
+	Publication *arweave.Publication `json:"publication,omitempty"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+// BlockTranslation the translation of a source block,
+// reused as long as the fingerprint of the block is unchanged
+type BlockTranslation struct {
+	notionopt.Fingerprint
+	// Segments translated markup of the segments of the block, see notionopt.CollectSegments
+	Segments []string `json:"segments"`
+}
+
+// translationKey one translated page per source page, language, output mode and destination
+func translationKey(sourceId, language, mode string, dest destination) string {
+	return fmt.Sprintf("%s/%s/%s/%s", notionopt.NormalizeID(sourceId), language, mode, notionopt.NormalizeID(dest.ID))
+}
+
+// translationLock a lock of a translation key, dropped when no job holds or waits for it
+type translationLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var (
+	translationLocksMu sync.Mutex
+	translationLocks   = make(map[string]*translationLock)
+)
+
+// lockTranslation serializing the jobs of the same translation key,
+// the second job then updates the page created by the first one
+// @Return unlock, releasing the key
+func lockTranslation(key string) (unlock func()) {
+	translationLocksMu.Lock()
+	lock, ok := translationLocks[key]
+	if !ok {
+		lock = &translationLock{}
+		translationLocks[key] = lock
+	}
+	lock.refs++
+	translationLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		translationLocksMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(translationLocks, key)
+		}
+		translationLocksMu.Unlock()
+	}
+}
+
+// configFlag returns the boolean config value, def if not set
+func configFlag(key string, def bool) bool {
+	if viper.IsSet(key) {
+		return viper.GetBool(key)
+	}
+	return def
+}
+
+// loadTranslation returns the previous translation of the key,
+// nil if the source page was never translated
+func loadTranslation(key string) (*TranslationRecord, error) {
+	var record TranslationRecord
+	found, err := db.Get(translationsBucket, key, &record)
+	if err != nil {
+		return nil, fmt.Errorf("load translation record error: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func saveTranslation(key string, record TranslationRecord) error {
+	record.UpdatedAt = time.Now()
+	err := db.Put(translationsBucket, key, record)
+	if err != nil {
+		return fmt.Errorf("save translation record error: %w", err)
+	}
+	return nil
+}
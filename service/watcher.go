@@ -0,0 +1,489 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/notionopt"
+	"github.com/permadao/transbot/translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// watcherBucket store bucket of the watched rows, see watchState
+const watcherBucket = "watcher"
+
+// Translation status of a watched row, by language
+const (
+	WatchTranslating = "translating"
+	WatchTranslated  = "translated"
+	WatchFailed      = "failed"
+)
+
+// WatchedDatabase a notion database whose rows are translated automatically
+// when created or edited, see <watcher.databases>
+type WatchedDatabase struct {
+	ID string `mapstructure:"id"`
+	// Languages target languages of every row, unless LanguagesProperty is set
+	Languages []string `mapstructure:"languages"`
+	// Mode output mode, see ModeTranslation
+	Mode string `mapstructure:"mode"`
+	// Destination parent page or database of the translations, see resolveDestination
+	Destination string `mapstructure:"destination"`
+	// LanguagesProperty a multi-select property with the target languages of the row,
+	// rows with no language selected are skipped
+	LanguagesProperty string `mapstructure:"languages_property"`
+	// StatusProperty a rich text, select or status property the translation status
+	// is written to, empty to leave the row untouched
+	StatusProperty string `mapstructure:"status_property"`
+	// Publish publishing the translations to arweave, <arweave.publish> if not set
+	Publish *bool `mapstructure:"publish"`
+}
+
+// watchState translation state of a watched row
+type watchState struct {
+	// Seen end of the edit minute of the row when its translation was last submitted,
+	// edits from then on by anyone but transbot are made by the author
+	Seen time.Time `json:"seen"`
+	// Edited the author edited the row after Seen, found before transbot wrote
+	// to the row and became its last editor, see checkAuthorEdit
+	Edited bool `json:"edited,omitempty"`
+	// Languages translation status by language code
+	Languages map[string]string `json:"languages"`
+}
+
+// watchMu serializing the updates of the watch states,
+// never held across notion calls
+var watchMu sync.Mutex
+
+// integration the bot user of the notion integration, see editedByIntegration
+var integration struct {
+	sync.Mutex
+	id string
+}
+
+// watcher polling the watched databases and submitting translation jobs
+// for new and edited rows
+type watcher struct {
+	mu sync.Mutex
+	// running jobs by row id and language
+	running map[string]bool
+	// polled start time of the last complete poll by database id,
+	// later polls only query the rows edited since
+	polled map[string]time.Time
+	// failed databases with a failed job since their last poll,
+	// queried in full on the next poll to submit the failed languages again
+	failed map[string]bool
+}
+
+// StartWatcher polling <watcher.databases> every <watcher.interval> in the background
+func StartWatcher() {
+	interval := 5 * time.Minute
+	if viper.IsSet("watcher.interval") {
+		interval = viper.GetDuration("watcher.interval")
+	}
+	w := &watcher{
+		running: make(map[string]bool),
+		polled:  make(map[string]time.Time),
+		failed:  make(map[string]bool),
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			w.poll()
+			<-ticker.C
+		}
+	}()
+	log.Infof("database watcher started, interval: %s", interval)
+}
+
+func (w *watcher) poll() {
+	var databases []WatchedDatabase
+	err := viper.UnmarshalKey("watcher.databases", &databases)
+	if err != nil {
+		log.Error("parse watched databases error: ", err.Error())
+		return
+	}
+	// edits of the integration are told from those of the author by the user id
+	_, err = integrationID()
+	if err != nil {
+		log.Error("watcher: get integration user error: ", err.Error())
+		return
+	}
+	translated, err := translatedPages()
+	if err != nil {
+		log.Error("watcher error: ", err.Error())
+		return
+	}
+	for _, database := range databases {
+		err = w.pollDatabase(database, translated)
+		if err != nil {
+			log.WithField("database", database.ID).Error("watch database error: ", err.Error())
+		}
+	}
+}
+
+// pollDatabase submitting a job for every language of the rows
+// created or edited since their last translation
+func (w *watcher) pollDatabase(database WatchedDatabase, translated map[string]bool) error {
+	opts := translateOptions{Mode: database.Mode, Destination: database.Destination}
+	if opts.Mode == "" {
+		opts.Mode = ModeTranslation
+	}
+	if !validMode(opts.Mode) {
+		return fmt.Errorf("%w: %s", ErrUnknownMode, opts.Mode)
+	}
+	publish, err := publishOption(database.Publish)
+	if err != nil {
+		return err
+	}
+	opts.Publish = publish
+
+	// all rows on the first poll and after a failed job,
+	// then the rows edited since the last complete poll
+	w.mu.Lock()
+	failed := w.failed[database.ID]
+	delete(w.failed, database.ID)
+	w.mu.Unlock()
+	query := &notion.DatabaseQuery{}
+	if since, ok := w.polled[database.ID]; ok && !failed {
+		// notion rounds the edit time down to the minute
+		after := since.Add(-time.Minute)
+		query.Filter = &notion.DatabaseQueryFilter{
+			Timestamp: notion.TimestampLastEditedTime,
+			DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+				LastEditedTime: &notion.DatePropertyFilter{OnOrAfter: &after},
+			},
+		}
+	}
+	start := time.Now()
+	pages, err := transbot.NotionClient.QueryDatabase(database.ID, query)
+	if err != nil {
+		return fmt.Errorf("query database error: %w", err)
+	}
+
+	complete := true
+	for _, page := range pages {
+		if page.Archived || translated[notionopt.NormalizeID(page.ID)] {
+			// rows created by transbot are not translated again
+			continue
+		}
+
+		var state watchState
+		found, err := db.Get(watcherBucket, notionopt.NormalizeID(page.ID), &state)
+		if err != nil {
+			return fmt.Errorf("load watch state error: %w", err)
+		}
+		edited := !found || state.Edited || authorEdited(page, state.Seen)
+		var languages []translator.Language
+		for _, language := range rowLanguages(database, page) {
+			if status, ok := state.Languages[language.Code]; ok && status != WatchFailed && !edited {
+				continue
+			}
+			languages = append(languages, language)
+		}
+		if len(languages) == 0 {
+			continue
+		}
+		if w.isRunning(page.ID, languages) {
+			// the edit is taken up once the running job is done,
+			// the next poll must query the row again
+			complete = false
+			continue
+		}
+
+		if edited {
+			if start.Before(editMinuteEnd(page)) {
+				// later edits in the same minute would get the same edit time,
+				// the row is translated once the minute is over
+				complete = false
+				continue
+			}
+			err = updateWatchState(page.ID, func(state *watchState) {
+				state.Seen = editMinuteEnd(page)
+				state.Edited = false
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, language := range languages {
+			w.submit(database, page, language, opts)
+		}
+	}
+	if complete {
+		w.polled[database.ID] = start
+	}
+	return nil
+}
+
+// isRunning returns true if a job of the row is running for any of the languages
+func (w *watcher) isRunning(pageId string, languages []translator.Language) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, language := range languages {
+		if w.running[notionopt.NormalizeID(pageId)+"/"+language.Code] {
+			return true
+		}
+	}
+	return false
+}
+
+// submit translating the row in a new job, unless it is running already
+func (w *watcher) submit(database WatchedDatabase, page notion.Page, language translator.Language, opts translateOptions) {
+	key := notionopt.NormalizeID(page.ID) + "/" + language.Code
+	w.mu.Lock()
+	if w.running[key] {
+		w.mu.Unlock()
+		return
+	}
+	w.running[key] = true
+	w.mu.Unlock()
+
+	setStatus(database, page, language.Code, WatchTranslating)
+	jobs.Submit(page.ID, language.Code, func(job *Job) error {
+		defer func() {
+			w.mu.Lock()
+			delete(w.running, key)
+			w.mu.Unlock()
+		}()
+
+		err := translate_segmentation(job, page.ID, language, opts)
+		if err != nil {
+			setStatus(database, page, language.Code, WatchFailed)
+			w.mu.Lock()
+			w.failed[database.ID] = true
+			w.mu.Unlock()
+			return err
+		}
+		setStatus(database, page, language.Code, WatchTranslated)
+		return nil
+	})
+}
+
+// setStatus recording the translation status of a language of the row,
+// and writing it to the status property of the row
+func setStatus(database WatchedDatabase, page notion.Page, language, status string) {
+	var languages map[string]string
+	err := updateWatchState(page.ID, func(state *watchState) {
+		if state.Languages == nil {
+			state.Languages = make(map[string]string)
+		}
+		state.Languages[language] = status
+		languages = make(map[string]string, len(state.Languages))
+		for code, status := range state.Languages {
+			languages[code] = status
+		}
+	})
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	if database.StatusProperty == "" {
+		return
+	}
+	value, ok := statusValue(page, database.StatusProperty, languages)
+	if !ok {
+		return
+	}
+
+	// writing the status edits the row, which must not trigger a translation
+	checkAuthorEdit(page.ID)
+	_, err = transbot.NotionClient.UpdatePageProperty(page.ID, database.StatusProperty, value)
+	if err != nil {
+		log.WithField("page", page.ID).Warn("write translation status error: ", err.Error())
+	}
+}
+
+// updateWatchState loading, updating and saving the watch state of the row
+func updateWatchState(pageId string, update func(state *watchState)) error {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+
+	key := notionopt.NormalizeID(pageId)
+	var state watchState
+	_, err := db.Get(watcherBucket, key, &state)
+	if err != nil {
+		return fmt.Errorf("load watch state error: %w", err)
+	}
+	update(&state)
+	err = db.Put(watcherBucket, key, state)
+	if err != nil {
+		return fmt.Errorf("save watch state error: %w", err)
+	}
+	return nil
+}
+
+// checkAuthorEdit recording an edit of the author not translated yet, before
+// transbot writes to the row and becomes its last editor, see pollDatabase.
+// Pages which are not watched are left alone.
+func checkAuthorEdit(pageId string) {
+	key := notionopt.NormalizeID(pageId)
+	var state watchState
+	watchMu.Lock()
+	found, err := db.Get(watcherBucket, key, &state)
+	watchMu.Unlock()
+	if err != nil {
+		log.Error("load watch state error: ", err.Error())
+		return
+	}
+	if !found || state.Edited {
+		return
+	}
+
+	page, err := transbot.NotionClient.FindPage(pageId)
+	if err != nil {
+		log.WithField("page", pageId).Warn("check author edit error: ", err.Error())
+		return
+	}
+	if !authorEdited(page, state.Seen) {
+		return
+	}
+	err = updateWatchState(pageId, func(state *watchState) {
+		state.Edited = true
+	})
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// authorEdited the row was edited from seen on, by someone else than transbot.
+// The edit time is rounded down to the minute, an edit in the minute ending at
+// seen has the edit time seen - 1 minute.
+func authorEdited(page notion.Page, seen time.Time) bool {
+	return !page.LastEditedTime.Before(seen) && !editedByIntegration(page)
+}
+
+// editMinuteEnd the end of the minute the row was last edited in,
+// the edit time of notion being rounded down to the minute
+func editMinuteEnd(page notion.Page) time.Time {
+	return page.LastEditedTime.Truncate(time.Minute).Add(time.Minute)
+}
+
+// editedByIntegration transbot is the last editor of the page
+func editedByIntegration(page notion.Page) bool {
+	if page.LastEditedBy == nil {
+		return false
+	}
+	id, err := integrationID()
+	if err != nil {
+		log.Warn("get integration user error: ", err.Error())
+		return false
+	}
+	return notionopt.NormalizeID(page.LastEditedBy.ID) == notionopt.NormalizeID(id)
+}
+
+// integrationID the user id of the integration, fetched once
+func integrationID() (string, error) {
+	integration.Lock()
+	defer integration.Unlock()
+	if integration.id != "" {
+		return integration.id, nil
+	}
+	id, err := transbot.NotionClient.CurrentUserID()
+	if err != nil {
+		return "", err
+	}
+	integration.id = id
+	return id, nil
+}
+
+// rowLanguages target languages of the row, from the languages property if configured
+func rowLanguages(database WatchedDatabase, page notion.Page) []translator.Language {
+	names := database.Languages
+	if database.LanguagesProperty != "" {
+		names = nil
+		props, _ := page.Properties.(notion.DatabasePageProperties)
+		for _, option := range props[database.LanguagesProperty].MultiSelect {
+			names = append(names, option.Name)
+		}
+	}
+
+	var languages []translator.Language
+	for _, name := range names {
+		language, ok := translator.LookupLanguage(name)
+		if !ok {
+			log.WithField("page", page.ID).Warnf("watcher: unknown language %s", name)
+			continue
+		}
+		languages = append(languages, language)
+	}
+	return languages
+}
+
+// statusValue the value of the status property: the status of every language
+// for a rich text property, the overall status for a select or status property
+func statusValue(page notion.Page, property string, languages map[string]string) (interface{}, bool) {
+	props, _ := page.Properties.(notion.DatabasePageProperties)
+	prop, ok := props[property]
+	if !ok {
+		log.WithField("page", page.ID).Warnf("watcher: row has no property %s", property)
+		return nil, false
+	}
+
+	codes := make([]string, 0, len(languages))
+	overall := WatchTranslated
+	for code, status := range languages {
+		codes = append(codes, code)
+		switch {
+		case status == WatchTranslating:
+			overall = WatchTranslating
+		case status == WatchFailed && overall != WatchTranslating:
+			overall = WatchFailed
+		}
+	}
+	sort.Strings(codes)
+
+	switch prop.Type {
+	case notion.DBPropTypeRichText:
+		lines := make([]string, len(codes))
+		for i, code := range codes {
+			lines[i] = code + ": " + languages[code]
+		}
+		text := strings.Join(lines, "\n")
+		return map[string]interface{}{
+			"rich_text": []map[string]interface{}{
+				{"type": "text", "text": map[string]string{"content": text}},
+			},
+		}, true
+	case notion.DBPropTypeSelect, notion.DBPropTypeStatus:
+		return map[string]interface{}{
+			string(prop.Type): map[string]string{"name": overall},
+		}, true
+	default:
+		log.WithField("page", page.ID).Warnf("watcher: unsupported status property type %s", prop.Type)
+		return nil, false
+	}
+}
+
+// translatedPages ids of the pages and rows created by translations,
+// including those of running jobs not recorded yet
+func translatedPages() (map[string]bool, error) {
+	pages := make(map[string]bool)
+	err := db.ForEach(translationsBucket, func(key string, value []byte) error {
+		var record struct {
+			PageID string `json:"page_id"`
+		}
+		err := json.Unmarshal(value, &record)
+		if err != nil {
+			return err
+		}
+		pages[notionopt.NormalizeID(record.PageID)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load translation records error: %w", err)
+	}
+	for _, job := range jobs.List() {
+		if job.NewPageID != "" {
+			pages[notionopt.NormalizeID(job.NewPageID)] = true
+		}
+	}
+	return pages, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cryptowizard0/go-notion"
+)
+
+func TestAuthorEdited(t *testing.T) {
+	integration.id = "bot"
+	defer func() { integration.id = "" }()
+
+	minute := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	author := &notion.BaseUser{ID: "author"}
+	bot := &notion.BaseUser{ID: "bot"}
+	tests := []struct {
+		name   string
+		edited time.Time
+		by     *notion.BaseUser
+		seen   time.Time
+		want   bool
+	}{
+		{"same minute as the translation", minute, author, minute.Add(time.Minute), false},
+		{"next minute", minute.Add(time.Minute), author, minute.Add(time.Minute), true},
+		{"later", minute.Add(time.Hour), author, minute.Add(time.Minute), true},
+		{"edited in the seen minute", minute, author, minute, true},
+		{"edited by transbot", minute.Add(time.Hour), bot, minute.Add(time.Minute), false},
+		{"unknown editor", minute.Add(time.Hour), nil, minute.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := notion.Page{LastEditedTime: tt.edited, LastEditedBy: tt.by}
+			if got := authorEdited(page, tt.seen); got != tt.want {
+				t.Errorf("authorEdited() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditMinuteEnd(t *testing.T) {
+	edited := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	got := editMinuteEnd(notion.Page{LastEditedTime: edited})
+	if want := edited.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("editMinuteEnd() = %s, want %s", got, want)
+	}
+	// the edit of the translation is not seen as an author edit
+	if authorEdited(notion.Page{LastEditedTime: edited, LastEditedBy: &notion.BaseUser{ID: "author"}}, got) {
+		t.Errorf("the translated edit is seen again")
+	}
+}
@@ -0,0 +1,54 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Request a single translation request sent to a backend
+type Request struct {
+	// Prompt the full instruction for chat model backends
+	Prompt string
+	// Text the source text to be translated
+	Text           string
+	TargetLanguage Language
+	// Markup the text contains notionopt rich text markup tags
+	Markup bool
+	// Glossary terms occurring in the text, already part of the prompt
+	Glossary []Term
+}
+
+// Backend a translation provider
+type Backend interface {
+	// Name of the backend, as configured in translator.backend
+	Name() string
+	// Model identifies the model or engine producing the translations
+	Model() string
+	// Translate returns the translated text for the request
+	Translate(ctx context.Context, req *Request) (string, error)
+}
+
+// NewBackend creating the backend selected by name,
+// settings are read from the section of the same name in config.toml
+func NewBackend(name string) (Backend, error) {
+	switch name {
+	case "", "openai":
+		return NewOpenAIBackend(
+			viper.GetString("openai.api_key"),
+			viper.GetString("openai.base_url"),
+			viper.GetString("openai.model"),
+			viper.GetFloat64("openai.temperature"),
+		), nil
+	case "deepl":
+		return NewDeepLBackend(
+			viper.GetString("deepl.api_key"),
+			viper.GetString("deepl.base_url"),
+		), nil
+	case "mock":
+		return NewMockBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown translator backend: %s", name)
+	}
+}
@@ -0,0 +1,91 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cryptowizard0/notion2arweave/utils"
+	"github.com/go-resty/resty/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeepLBackend translating with a DeepL style http api
+// See: https://www.deepl.com/docs-api/translate-text
+type DeepLBackend struct {
+	httpClient *resty.Client
+}
+
+func NewDeepLBackend(apiKey, baseURL string) *DeepLBackend {
+	if baseURL == "" {
+		baseURL = "https://api-free.deepl.com"
+	}
+	client := resty.New()
+	client.SetHeader("Accept", "application/json").
+		SetHeader("Authorization", "DeepL-Auth-Key "+apiKey).
+		SetBaseURL(baseURL)
+
+	return &DeepLBackend{
+		httpClient: client,
+	}
+}
+
+func (b *DeepLBackend) Name() string {
+	return "deepl"
+}
+
+func (b *DeepLBackend) Model() string {
+	return "deepl"
+}
+
+func (b *DeepLBackend) Translate(ctx context.Context, req *Request) (string, error) {
+	form := map[string]string{
+		"text":        req.Text,
+		"target_lang": deeplLanguage(req.TargetLanguage),
+	}
+	if req.Markup {
+		// keep the rich text markup tags
+		form["tag_handling"] = "xml"
+	}
+
+	var result struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	resp, err := b.httpClient.R().
+		SetContext(ctx).
+		SetFormData(form).
+		SetResult(&result).
+		Post("/v2/translate")
+	if err != nil {
+		log.Error("deepl request error: ", err.Error())
+		return "", err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		utils.LogResp_Error(resp)
+		return "", &StatusError{Backend: "deepl", StatusCode: resp.StatusCode(), Body: resp.String()}
+	}
+	if len(result.Translations) == 0 {
+		return "", errors.New("deepl: empty translations")
+	}
+
+	return result.Translations[0].Text, nil
+}
+
+// DeepL expects its own upper case language codes
+func deeplLanguage(lang Language) string {
+	switch lang.Code {
+	case "en":
+		return "EN-US"
+	case "pt":
+		return "PT-BR"
+	case "zh-Hans":
+		return "ZH-HANS"
+	case "zh-Hant":
+		return "ZH-HANT"
+	default:
+		return strings.ToUpper(lang.Code)
+	}
+}
@@ -0,0 +1,26 @@
+package translator
+
+import "testing"
+
+func TestDeeplLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"en", "EN-US"},
+		{"pt", "PT-BR"},
+		{"zh-Hans", "ZH-HANS"},
+		{"zh-Hant", "ZH-HANT"},
+		{"ja", "JA"},
+		{"de", "DE"},
+	}
+	for _, tt := range tests {
+		language, ok := LookupLanguage(tt.code)
+		if !ok {
+			t.Fatalf("unknown language %s", tt.code)
+		}
+		if got := deeplLanguage(language); got != tt.want {
+			t.Errorf("deeplLanguage(%s) = %s, want %s", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+)
+
+// MockBackend a deterministic offline backend for development,
+// the "translation" is the source text prefixed with the target language code.
+type MockBackend struct{}
+
+func NewMockBackend() *MockBackend {
+	return &MockBackend{}
+}
+
+func (b *MockBackend) Name() string {
+	return "mock"
+}
+
+func (b *MockBackend) Model() string {
+	return "mock"
+}
+
+func (b *MockBackend) Translate(ctx context.Context, req *Request) (string, error) {
+	prefix := fmt.Sprintf("[%s] ", req.TargetLanguage.Code)
+	if batchSegmentReg.MatchString(req.Text) {
+		// prefix every segment of a batch
+		return batchSegmentReg.ReplaceAllString(req.Text, `<seg id="$1">`+prefix+`$2</seg>`), nil
+	}
+	return prefix + req.Text, nil
+}
@@ -0,0 +1,64 @@
+package translator
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sashabaranov/go-openai"
+	log "github.com/sirupsen/logrus"
+)
+
+// OpenAIBackend translating with an OpenAI compatible chat completion endpoint.
+// Self-hosted or proxy servers are supported by setting the base url.
+type OpenAIBackend struct {
+	client      *openai.Client
+	model       string
+	temperature float64
+}
+
+func NewOpenAIBackend(apiKey, baseURL, model string, temperature float64) *OpenAIBackend {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	return &OpenAIBackend{
+		client:      openai.NewClientWithConfig(config),
+		model:       model,
+		temperature: temperature,
+	}
+}
+
+func (b *OpenAIBackend) Name() string {
+	return "openai"
+}
+
+func (b *OpenAIBackend) Model() string {
+	return b.model
+}
+
+func (b *OpenAIBackend) Translate(ctx context.Context, req *Request) (string, error) {
+	log.Info("chat completion: ", req.Prompt)
+	resp, err := b.client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model:       b.model,
+			Temperature: float32(b.temperature),
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: req.Prompt,
+				},
+			},
+		},
+	)
+	if err != nil {
+		log.Error("chat completion content error:", err.Error())
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("chat completion: empty choices")
+	}
+
+	log.Info("openai: ", resp.Choices[0].Message.Content)
+	return resp.Choices[0].Message.Content, nil
+}
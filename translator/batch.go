@@ -0,0 +1,103 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrBatchMismatch the batch response markers do not match the request
+var ErrBatchMismatch = errors.New("batch response segments do not match")
+
+var batchSegmentReg = regexp.MustCompile(`(?s)<seg id="(\d+)">(.*?)</seg>`)
+
+// TranslateBatch translating consecutive segments in notionopt markup with a single request.
+// Every segment is wrapped in a stable marker; if the response markers can not be
+// matched, segments are translated one by one.
+// Segments found in the translation memory are not sent again.
+func (a *Translator) TranslateBatch(contents []string, targetLanguage Language) ([]string, error) {
+	results := make([]string, len(contents))
+	requests := make([]*Request, len(contents))
+	var pending []int
+	for i, content := range contents {
+		requests[i] = a.markupRequest(content, targetLanguage)
+		if a.Memory != nil {
+			if traned, ok := a.Memory.Lookup(requests[i], a.Backend.Model()); ok {
+				results[i] = traned
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+
+	if len(pending) > 1 {
+		traned, err := a.translateSegments(contents, pending, targetLanguage)
+		if err == nil {
+			for j, i := range pending {
+				results[i] = traned[j]
+				a.remember(requests[i], traned[j])
+			}
+			return results, nil
+		}
+		if !errors.Is(err, ErrBatchMismatch) {
+			return nil, err
+		}
+		log.Warnf("batch of %d segments: %s, fallback to single requests", len(pending), err.Error())
+	}
+
+	for _, i := range pending {
+		traned, err := a.callAndRemember(requests[i])
+		if err != nil {
+			return nil, err
+		}
+		results[i] = traned
+	}
+	return results, nil
+}
+
+// translateSegments sending the pending segments in one request
+func (a *Translator) translateSegments(contents []string, pending []int, targetLanguage Language) ([]string, error) {
+	var sb strings.Builder
+	for j, i := range pending {
+		fmt.Fprintf(&sb, "<seg id=\"%d\">%s</seg>\n", j+1, contents[i])
+	}
+	text := sb.String()
+	terms := a.glossaryTerms(text, targetLanguage)
+
+	traned, err := a.call(&Request{
+		Prompt: fmt.Sprintf("Translate every segment to %s. Segments are wrapped in <seg id=\"N\">...</seg>, "+
+			"reply with every translated segment wrapped in the same tag and id, in the same order, "+
+			"and nothing else. Segments may contain formatting tags like <s0>...</s0> and placeholders "+
+			"like <m1/>, keep them unchanged around the corresponding translated words.%s\n%s",
+			targetLanguage, glossaryPrompt(terms), text),
+		Text:           text,
+		TargetLanguage: targetLanguage,
+		Markup:         true,
+		Glossary:       terms,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return splitSegments(traned, len(pending))
+}
+
+// splitSegments matching the response markers, ids must be 1..count in order
+func splitSegments(traned string, count int) ([]string, error) {
+	matches := batchSegmentReg.FindAllStringSubmatch(traned, -1)
+	if len(matches) != count {
+		return nil, fmt.Errorf("%w: expect %d segments, got %d", ErrBatchMismatch, count, len(matches))
+	}
+	segments := make([]string, count)
+	for j, match := range matches {
+		id, _ := strconv.Atoi(match[1])
+		if id != j+1 {
+			return nil, fmt.Errorf("%w: expect segment %d, got %d", ErrBatchMismatch, j+1, id)
+		}
+		segments[j] = strings.TrimSpace(match[2])
+	}
+	return segments, nil
+}
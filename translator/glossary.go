@@ -0,0 +1,233 @@
+package translator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cryptowizard0/go-notion"
+	"github.com/permadao/transbot/notionopt"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Term a glossary entry
+type Term struct {
+	// Source the term as written in the source text
+	Source string `mapstructure:"source" json:"source"`
+	// Language the target language, code or english name, empty for all languages
+	Language string `mapstructure:"language" json:"language,omitempty"`
+	// Target the mandated translation, empty keeps the source term untranslated
+	Target string `mapstructure:"target" json:"target,omitempty"`
+}
+
+// Expected returns the text the translation must contain
+func (t Term) Expected() string {
+	if t.Target == "" {
+		return t.Source
+	}
+	return t.Target
+}
+
+var wordTermReg = regexp.MustCompile(`^\w(.*\w)?$`)
+
+// Glossary project names, tickers and protocol terms with mandated translations
+type Glossary struct {
+	Terms []Term
+	// matchers compiled for every term, same order as Terms
+	matchers []*regexp.Regexp
+}
+
+func NewGlossary(terms []Term) *Glossary {
+	g := &Glossary{}
+	for _, term := range terms {
+		term.Source = strings.TrimSpace(term.Source)
+		term.Language = strings.TrimSpace(term.Language)
+		term.Target = strings.TrimSpace(term.Target)
+		if term.Source == "" {
+			continue
+		}
+		if _, ok := LookupLanguage(term.Language); term.Language != "" && !ok {
+			log.Warnf("glossary term %s: unknown language %s", term.Source, term.Language)
+		}
+		g.Terms = append(g.Terms, term)
+		g.matchers = append(g.matchers, termMatcher(term.Source))
+	}
+	return g
+}
+
+// LoadGlossary loading the glossary configured in config.toml
+// @Return nil glossary if not configured
+func LoadGlossary(n *notionopt.NotionOperator) (*Glossary, error) {
+	var terms []Term
+	if file := viper.GetString("glossary.file"); file != "" {
+		fileTerms, err := loadGlossaryFile(file)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, fileTerms...)
+	}
+	if dbId := viper.GetString("glossary.notion_database"); dbId != "" {
+		dbTerms, err := loadGlossaryNotion(n, dbId)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, dbTerms...)
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	log.Infof("glossary loaded, %d terms", len(terms))
+	return NewGlossary(terms), nil
+}
+
+// Relevant returns terms occurring in the content, for the target language
+func (g *Glossary) Relevant(content string, targetLanguage Language) []Term {
+	var terms []Term
+	for i, term := range g.Terms {
+		if term.Language != "" {
+			lang, ok := LookupLanguage(term.Language)
+			if !ok || lang.Code != targetLanguage.Code {
+				continue
+			}
+		}
+		if g.matchers[i].MatchString(content) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Check returns the source terms whose mandated translation
+// is missing in the translated text
+func (g *Glossary) Check(source, translated string, targetLanguage Language) []string {
+	var missing []string
+	for _, term := range g.Relevant(source, targetLanguage) {
+		if !termMatcher(term.Expected()).MatchString(translated) {
+			missing = append(missing, term.Source)
+		}
+	}
+	return missing
+}
+
+// Prompt instruction listing the terms
+func glossaryPrompt(terms []Term) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nUse this glossary, translate each term exactly as given:\n")
+	for _, term := range terms {
+		if term.Target == "" {
+			fmt.Fprintf(&sb, "- %s -> %s (do not translate)\n", term.Source, term.Source)
+		} else {
+			fmt.Fprintf(&sb, "- %s -> %s\n", term.Source, term.Target)
+		}
+	}
+	return sb.String()
+}
+
+// Word terms only match whole words, others (like CJK terms) match anywhere
+func termMatcher(source string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(source)
+	if wordTermReg.MatchString(source) {
+		pattern = `\b` + pattern + `\b`
+	}
+	return regexp.MustCompile(`(?i)` + pattern)
+}
+
+// loadGlossaryFile loading terms from a .toml file with [[terms]] tables,
+// or a .csv file with source,language,target columns
+func loadGlossaryFile(file string) ([]Term, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".toml":
+		v := viper.New()
+		v.SetConfigFile(file)
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, fmt.Errorf("read glossary error: %w", err)
+		}
+		var terms []Term
+		err = v.UnmarshalKey("terms", &terms)
+		if err != nil {
+			return nil, fmt.Errorf("parse glossary error: %w", err)
+		}
+		return terms, nil
+	case ".csv":
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("read glossary error: %w", err)
+		}
+		defer f.Close()
+		return parseGlossaryCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported glossary file: %s", file)
+	}
+}
+
+func parseGlossaryCSV(r io.Reader) ([]Term, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse glossary error: %w", err)
+	}
+
+	var terms []Term
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "source") {
+			continue // header
+		}
+		term := Term{Source: record[0]}
+		if len(record) > 1 {
+			term.Language = record[1]
+		}
+		if len(record) > 2 {
+			term.Target = record[2]
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// loadGlossaryNotion loading terms from a notion database,
+// the column names are configured in the glossary section
+func loadGlossaryNotion(n *notionopt.NotionOperator, dbId string) ([]Term, error) {
+	sourceProp := viper.GetString("glossary.source_property")
+	if sourceProp == "" {
+		sourceProp = "Term"
+	}
+	languageProp := viper.GetString("glossary.language_property")
+	if languageProp == "" {
+		languageProp = "Language"
+	}
+	targetProp := viper.GetString("glossary.target_property")
+	if targetProp == "" {
+		targetProp = "Translation"
+	}
+
+	pages, err := n.QueryDatabase(dbId, nil)
+	if err != nil {
+		return nil, fmt.Errorf("query glossary database error: %w", err)
+	}
+
+	var terms []Term
+	for _, page := range pages {
+		props, ok := page.Properties.(notion.DatabasePageProperties)
+		if !ok {
+			continue
+		}
+		terms = append(terms, Term{
+			Source:   notionopt.GetPropertyText(props[sourceProp]),
+			Language: notionopt.GetPropertyText(props[languageProp]),
+			Target:   notionopt.GetPropertyText(props[targetProp]),
+		})
+	}
+	return terms, nil
+}
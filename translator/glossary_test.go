@@ -0,0 +1,34 @@
+package translator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlossaryCheck(t *testing.T) {
+	chinese, _ := LookupLanguage("zh")
+	glossary := NewGlossary([]Term{
+		{Source: "AR"},
+		{Source: "Arweave", Language: "zh", Target: "阿维"},
+		{Source: "permaweb", Language: "fr", Target: "permaweb"},
+	})
+	tests := []struct {
+		name       string
+		source     string
+		translated string
+		want       []string
+	}{
+		{"present", "Pay with AR on Arweave", "在阿维上用 AR 支付", nil},
+		{"case insensitive", "Pay with AR", "用 ar 支付", nil},
+		{"inside a word", "Pay with AR", "Arweave 翻译", []string{"AR"}},
+		{"missing target", "Arweave is here", "Arweave 在这里", []string{"Arweave"}},
+		{"other language", "the permaweb", "永久网络", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := glossary.Check(tt.source, tt.translated, chinese); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package translator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/permadao/transbot/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// PromptVersion must be bumped whenever the prompts change,
+// so that translations made with older prompts are not reused.
+const PromptVersion = "2"
+
+const memoryBucket = "translation_memory"
+
+type memoryEntry struct {
+	Language      string    `json:"language"`
+	Model         string    `json:"model"`
+	PromptVersion string    `json:"prompt_version"`
+	Translation   string    `json:"translation"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// MemoryStats hit and miss counters since start, and the stored entries
+type MemoryStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// Memory a persistent translation memory, keyed by
+// (source text hash, target language, model, prompt version)
+type Memory struct {
+	hits   uint64
+	misses uint64
+	store  *store.Store
+}
+
+func NewMemory(s *store.Store) *Memory {
+	return &Memory{store: s}
+}
+
+// Lookup returns the stored translation of the request
+func (m *Memory) Lookup(req *Request, model string) (string, bool) {
+	var entry memoryEntry
+	found, err := m.store.Get(memoryBucket, memoryKey(req, model), &entry)
+	if err != nil {
+		log.Error("translation memory lookup error: ", err.Error())
+	}
+	if !found || err != nil {
+		atomic.AddUint64(&m.misses, 1)
+		return "", false
+	}
+	atomic.AddUint64(&m.hits, 1)
+	return entry.Translation, true
+}
+
+// Save storing the translation of the request
+func (m *Memory) Save(req *Request, model, translation string) {
+	entry := memoryEntry{
+		Language:      req.TargetLanguage.Code,
+		Model:         model,
+		PromptVersion: PromptVersion,
+		Translation:   translation,
+		CreatedAt:     time.Now(),
+	}
+	err := m.store.Put(memoryBucket, memoryKey(req, model), &entry)
+	if err != nil {
+		log.Error("translation memory save error: ", err.Error())
+	}
+}
+
+// Purge deleting entries of the language (BCP-47 code) and/or model, empty matches all.
+// Unreadable entries are only deleted without filter, their language and model are unknown.
+// @Return deleted, number of deleted entries
+func (m *Memory) Purge(language, model string) (int, error) {
+	return m.store.DeleteFunc(memoryBucket, func(key string, value []byte) bool {
+		var entry memoryEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return language == "" && model == ""
+		}
+		return (language == "" || entry.Language == language) &&
+			(model == "" || entry.Model == model)
+	})
+}
+
+func (m *Memory) Stats() (MemoryStats, error) {
+	entries, err := m.store.Count(memoryBucket)
+	return MemoryStats{
+		Hits:    atomic.LoadUint64(&m.hits),
+		Misses:  atomic.LoadUint64(&m.misses),
+		Entries: entries,
+	}, err
+}
+
+func memoryKey(req *Request, model string) string {
+	// glossary terms change the prompt, translations made without them must not be reused
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%t\x00%s\x00%v", req.Markup, req.Text, req.Glossary)))
+	return fmt.Sprintf("%s/%s/%s/%s", model, req.TargetLanguage.Code, PromptVersion, hex.EncodeToString(sum[:]))
+}
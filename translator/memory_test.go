@@ -0,0 +1,50 @@
+package translator
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/permadao/transbot/store"
+)
+
+func TestMemoryPurge(t *testing.T) {
+	french, _ := LookupLanguage("fr")
+	german, _ := LookupLanguage("de")
+	tests := []struct {
+		name     string
+		language string
+		model    string
+		deleted  int
+	}{
+		{"language", "fr", "", 2},
+		{"model", "", "gpt-4o", 2},
+		{"language and model", "de", "gpt-4o", 1},
+		{"no filter", "", "", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := store.Open(filepath.Join(t.TempDir(), "transbot.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			memory := NewMemory(db)
+			memory.Save(&Request{Text: "a", TargetLanguage: french}, "gpt-4o", "A")
+			memory.Save(&Request{Text: "b", TargetLanguage: french}, "deepl", "B")
+			memory.Save(&Request{Text: "c", TargetLanguage: german}, "gpt-4o", "C")
+			memory.Save(&Request{Text: "d", TargetLanguage: german}, "deepl", "D")
+			// an entry written by another version, its language and model are unknown
+			if err := db.Put(memoryBucket, "unreadable", "not an entry"); err != nil {
+				t.Fatal(err)
+			}
+
+			deleted, err := memory.Purge(tt.language, tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("Purge() deleted %d entries, want %d", deleted, tt.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/permadao/transbot/utils"
+	"github.com/sashabaranov/go-openai"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// StatusError a backend http api answered with an error status code
+type StatusError struct {
+	Backend    string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: status code: %d, %s", e.Backend, e.StatusCode, e.Body)
+}
+
+// RetryPolicy timeout and retries of a single backend request
+type RetryPolicy struct {
+	Timeout    time.Duration
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Limits rate limits shared by all translation jobs
+type Limits struct {
+	requests *utils.Limiter
+	tokens   *utils.Limiter
+}
+
+func loadRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		Timeout:    viper.GetDuration("translator.timeout"),
+		MaxRetries: 3,
+		BaseDelay:  viper.GetDuration("translator.retry_base_delay"),
+		MaxDelay:   viper.GetDuration("translator.retry_max_delay"),
+	}
+	if viper.IsSet("translator.max_retries") {
+		policy.MaxRetries = viper.GetInt("translator.max_retries")
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = 2 * time.Minute
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = time.Second
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = 30 * time.Second
+	}
+	return policy
+}
+
+// loadLimits reading requests and tokens per minute, 0 disables a limit
+func loadLimits() Limits {
+	rpm := viper.GetFloat64("translator.requests_per_minute")
+	tpm := viper.GetFloat64("translator.tokens_per_minute")
+	return Limits{
+		requests: utils.NewLimiter(rpm/60, rpm),
+		tokens:   utils.NewLimiter(tpm/60, tpm),
+	}
+}
+
+// Wait blocking until the request fits into the rate limits
+func (l Limits) Wait(ctx context.Context, tokens int) error {
+	err := l.requests.Wait(ctx, 1)
+	if err != nil {
+		return err
+	}
+	return l.tokens.Wait(ctx, float64(tokens))
+}
+
+// EstimateTokens rough token count of a text, errs on the high side
+// for latin scripts (~4 bytes per token) and fits CJK (~3 bytes per token)
+func EstimateTokens(text string) int {
+	return len(text)/3 + 1
+}
+
+// IsRetryable reports whether a failed backend request is worth retrying:
+// rate limits, server errors, timeouts and network errors
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retryableStatus(reqErr.HTTPStatusCode)
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode)
+	}
+
+	// *url.Error is a net.Error too, so only timeouts are taken from it.
+	// Permanent failures like a bad scheme or an invalid certificate
+	// are neither timeouts nor network operation errors.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// call sending the request to the backend, waiting for the shared rate limits,
+// with a timeout per attempt and retries with backoff for retryable errors
+func (a *Translator) call(req *Request) (string, error) {
+	// prompt and a completion of about the same size
+	tokens := 2 * EstimateTokens(req.Prompt)
+
+	for attempt := 0; ; attempt++ {
+		err := a.limits.Wait(a.ctx, tokens)
+		if err != nil {
+			return "", err
+		}
+
+		ctx, cancel := context.WithTimeout(a.ctx, a.retry.Timeout)
+		traned, err := a.Backend.Translate(ctx, req)
+		cancel()
+		if err == nil {
+			return traned, nil
+		}
+		if !IsRetryable(err) || attempt >= a.retry.MaxRetries {
+			return "", err
+		}
+
+		delay := utils.Backoff(attempt, a.retry.BaseDelay, a.retry.MaxDelay)
+		log.Warnf("%s: attempt %d failed: %s, retry in %s", a.Backend.Name(), attempt+1, err.Error(), delay)
+		err = utils.Sleep(a.ctx, delay)
+		if err != nil {
+			return "", err
+		}
+	}
+}
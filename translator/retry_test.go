@@ -0,0 +1,88 @@
+package translator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://api.example.com/v1/chat", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadline", fmt.Errorf("translate error: %w", context.DeadlineExceeded), true},
+		{"cancelled", context.Canceled, false},
+		{"rate limited", &StatusError{StatusCode: 429}, true},
+		{"server error", &StatusError{StatusCode: 503}, true},
+		{"bad request", &StatusError{StatusCode: 400}, false},
+		{"timeout", urlErr(timeoutError{}), true},
+		{"connection refused", urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true},
+		{"connection reset", urlErr(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true},
+		{"closed connection", urlErr(io.EOF), true},
+		{"unsupported scheme", urlErr(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{"invalid certificate", urlErr(&tls.CertificateVerificationError{Err: errors.New("x509: unknown authority")}), false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+type failingBackend struct {
+	calls int
+}
+
+func (b *failingBackend) Name() string  { return "failing" }
+func (b *failingBackend) Model() string { return "test" }
+func (b *failingBackend) Translate(ctx context.Context, req *Request) (string, error) {
+	b.calls++
+	return "", &StatusError{Backend: "failing", StatusCode: 503}
+}
+
+func TestCallStopsOnClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &failingBackend{}
+	a := &Translator{
+		Backend: backend,
+		retry:   RetryPolicy{Timeout: time.Second, MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	time.AfterFunc(10*time.Millisecond, a.Close)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.call(&Request{Prompt: "hello"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("call error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call kept sleeping after Close")
+	}
+}
@@ -4,54 +4,144 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/permadao/transbot/assets"
 	"github.com/permadao/transbot/notionopt"
-	"github.com/sashabaranov/go-openai"
-	log "github.com/sirupsen/logrus"
+	"github.com/permadao/transbot/store"
 	"github.com/spf13/viper"
 )
 
 type Translator struct {
-	APIKey       string
-	AiClient     *openai.Client
+	Backend      Backend
 	NotionClient *notionopt.NotionOperator
-	Temperature  float64
-	Model        string
+	// Memory is nil if the translation memory is disabled
+	Memory *Memory
+	// Glossary is nil if no glossary is configured
+	Glossary *Glossary
+
+	retry  RetryPolicy
+	limits Limits
+	// ctx of all backend requests, cancelled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func CreateTranslator(apiKey, notionAuth string) *Translator {
+// CreateTranslator
+// @Pararm db, store for the translation memory, may be nil
+func CreateTranslator(notionAuth string, db *store.Store) (*Translator, error) {
+	backend, err := NewBackend(viper.GetString("translator.backend"))
+	if err != nil {
+		return nil, err
+	}
+
+	var memory *Memory
+	if db != nil && viper.GetBool("memory.enabled") {
+		memory = NewMemory(db)
+	}
+
+	assetStore, err := assets.NewAssetStore(viper.GetString("assets.backend"))
+	if err != nil {
+		return nil, fmt.Errorf("create asset store error: %w", err)
+	}
+	notionClient := notionopt.CreateNotionOperator(notionAuth, assetStore, db)
+	glossary, err := LoadGlossary(notionClient)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Translator{
-		APIKey:       apiKey,
-		AiClient:     openai.NewClient(apiKey),
-		NotionClient: notionopt.CreateNotionOperator(notionAuth),
-		Temperature:  viper.GetFloat64("openai.temperature"),
-		Model:        viper.GetString("openai.model"),
-	}
-}
-
-func (a *Translator) Translate(content, targetLanguage string) (string, error) {
-	c := fmt.Sprintf("Translate to %s: %s", targetLanguage, content)
-	return a.OpenAIRequest(c)
-}
-
-func (a *Translator) OpenAIRequest(content string) (string, error) {
-	log.Info("chat completion: ", content)
-	resp, err := a.AiClient.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: a.Model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: content,
-				},
-			},
-		},
-	)
+		Backend:      backend,
+		NotionClient: notionClient,
+		Memory:       memory,
+		Glossary:     glossary,
+		retry:        loadRetryPolicy(),
+		limits:       loadLimits(),
+		ctx:          ctx,
+		cancel:       cancel,
+	}, nil
+}
+
+// Close cancelling pending backend requests, rate limit waits and retry backoffs
+func (a *Translator) Close() {
+	a.cancel()
+}
+
+func (a *Translator) Translate(content string, targetLanguage Language) (string, error) {
+	terms := a.glossaryTerms(content, targetLanguage)
+	prompt := fmt.Sprintf("Translate to %s: %s", targetLanguage, content)
+	if len(terms) > 0 {
+		// the glossary goes before the content, so that it is not taken as text to translate
+		prompt = fmt.Sprintf("Translate to %s, reply with the translation only.%s\n%s",
+			targetLanguage, glossaryPrompt(terms), content)
+	}
+	return a.request(&Request{
+		Prompt:         prompt,
+		Text:           content,
+		TargetLanguage: targetLanguage,
+		Glossary:       terms,
+	})
+}
+
+// TranslateMarkup translating content in the rich text markup of notionopt,
+// formatting tags and placeholders must survive the translation.
+func (a *Translator) TranslateMarkup(content string, targetLanguage Language) (string, error) {
+	return a.request(a.markupRequest(content, targetLanguage))
+}
+
+func (a *Translator) markupRequest(content string, targetLanguage Language) *Request {
+	terms := a.glossaryTerms(content, targetLanguage)
+	return &Request{
+		Prompt: fmt.Sprintf("Translate to %s. The text may contain formatting tags like <s0>...</s0> "+
+			"and placeholders like <m1/>. Keep every tag and placeholder unchanged around the "+
+			"corresponding translated words, and reply with the translation only.%s\n%s",
+			targetLanguage, glossaryPrompt(terms), content),
+		Text:           content,
+		TargetLanguage: targetLanguage,
+		Markup:         true,
+		Glossary:       terms,
+	}
+}
+
+// CheckGlossary returns the glossary terms of the source
+// whose mandated translation is missing in the translated text
+func (a *Translator) CheckGlossary(source, translated string, targetLanguage Language) []string {
+	if a.Glossary == nil {
+		return nil
+	}
+	return a.Glossary.Check(source, translated, targetLanguage)
+}
+
+func (a *Translator) glossaryTerms(content string, targetLanguage Language) []Term {
+	if a.Glossary == nil {
+		return nil
+	}
+	return a.Glossary.Relevant(content, targetLanguage)
+}
+
+// request consulting the translation memory before calling the backend
+func (a *Translator) request(req *Request) (string, error) {
+	model := a.Backend.Model()
+	if a.Memory != nil {
+		if traned, ok := a.Memory.Lookup(req, model); ok {
+			return traned, nil
+		}
+	}
+
+	return a.callAndRemember(req)
+}
+
+func (a *Translator) callAndRemember(req *Request) (string, error) {
+	traned, err := a.call(req)
 	if err != nil {
-		log.Error("chat completion content error:", err.Error())
 		return "", err
 	}
+	a.remember(req, traned)
+	return traned, nil
+}
 
-	log.Info("openai: ", resp.Choices[0].Message.Content)
-	return resp.Choices[0].Message.Content, nil
+// remember saving the translation into the memory, if enabled
+func (a *Translator) remember(req *Request, traned string) {
+	if a.Memory != nil {
+		a.Memory.Save(req, a.Backend.Model(), traned)
+	}
 }
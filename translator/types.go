@@ -1,8 +1,101 @@
 package translator
 
-type TargetLanguage string
+import (
+	"sort"
+	"strings"
+)
+
+// TextDirection writing direction of a script
+type TextDirection string
 
 const (
-	CH TargetLanguage = "chinese"
-	EN TargetLanguage = "english"
+	LTR TextDirection = "ltr"
+	RTL TextDirection = "rtl"
 )
+
+// Language a supported target language
+type Language struct {
+	// Code BCP-47 language tag
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	NativeName string `json:"native_name"`
+	// Script ISO 15924 script code
+	Script    string        `json:"script"`
+	Direction TextDirection `json:"direction"`
+}
+
+// String returns the english name, used in prompts
+func (l Language) String() string {
+	return l.Name
+}
+
+// Language registry, keyed by lower case BCP-47 code
+var languages = map[string]Language{}
+
+// Alternative names and codes accepted for a language,
+// the lower case english names are accepted as well
+var languageAliases = map[string]string{
+	"zh":      "zh-Hans",
+	"zh-cn":   "zh-Hans",
+	"zh-sg":   "zh-Hans",
+	"zh-tw":   "zh-Hant",
+	"zh-hk":   "zh-Hant",
+	"chinese": "zh-Hans",
+	"en-us":   "en",
+	"en-gb":   "en",
+	"pt-br":   "pt",
+	"pt-pt":   "pt",
+}
+
+func init() {
+	for _, lang := range []Language{
+		{"en", "English", "English", "Latn", LTR},
+		{"zh-Hans", "Simplified Chinese", "简体中文", "Hans", LTR},
+		{"zh-Hant", "Traditional Chinese", "繁體中文", "Hant", LTR},
+		{"ja", "Japanese", "日本語", "Jpan", LTR},
+		{"ko", "Korean", "한국어", "Kore", LTR},
+		{"de", "German", "Deutsch", "Latn", LTR},
+		{"fr", "French", "Français", "Latn", LTR},
+		{"es", "Spanish", "Español", "Latn", LTR},
+		{"pt", "Portuguese", "Português", "Latn", LTR},
+		{"it", "Italian", "Italiano", "Latn", LTR},
+		{"nl", "Dutch", "Nederlands", "Latn", LTR},
+		{"pl", "Polish", "Polski", "Latn", LTR},
+		{"ru", "Russian", "Русский", "Cyrl", LTR},
+		{"uk", "Ukrainian", "Українська", "Cyrl", LTR},
+		{"tr", "Turkish", "Türkçe", "Latn", LTR},
+		{"vi", "Vietnamese", "Tiếng Việt", "Latn", LTR},
+		{"th", "Thai", "ไทย", "Thai", LTR},
+		{"id", "Indonesian", "Bahasa Indonesia", "Latn", LTR},
+		{"hi", "Hindi", "हिन्दी", "Deva", LTR},
+		{"ar", "Arabic", "العربية", "Arab", RTL},
+		{"he", "Hebrew", "עברית", "Hebr", RTL},
+		{"fa", "Persian", "فارسی", "Arab", RTL},
+	} {
+		languages[strings.ToLower(lang.Code)] = lang
+		languageAliases[strings.ToLower(lang.Name)] = lang.Code
+	}
+}
+
+// LookupLanguage finding a language by BCP-47 code, alias or english name,
+// case insensitive
+func LookupLanguage(s string) (Language, bool) {
+	key := strings.ToLower(strings.TrimSpace(s))
+	if code, ok := languageAliases[key]; ok {
+		key = strings.ToLower(code)
+	}
+	lang, ok := languages[key]
+	return lang, ok
+}
+
+// Languages returns all supported languages, sorted by code
+func Languages() []Language {
+	list := make([]Language, 0, len(languages))
+	for _, lang := range languages {
+		list = append(list, lang)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Code < list[j].Code
+	})
+	return list
+}
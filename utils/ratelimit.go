@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter a token bucket rate limiter, safe for concurrent use.
+// A nil Limiter never blocks.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter
+// @Pararm rate, tokens refilled per second, <= 0 disables the limiter
+// @Pararm burst, bucket size
+func NewLimiter(rate float64, burst float64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Wait taking n tokens, blocks until they are available or ctx is done.
+// Requests larger than the bucket are allowed, later callers wait longer.
+func (l *Limiter) Wait(ctx context.Context, n float64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= n
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	err := Sleep(ctx, wait)
+	if err != nil {
+		// give the reservation back
+		l.mu.Lock()
+		l.tokens += n
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// Sleep pausing for d, returns early with the context error
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff exponential backoff with full jitter for the attempt, starting at 0
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base << uint(attempt)
+	if d <= 0 || d > max {
+		d = max
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// RetryAfter parsing the Retry-After header, in seconds or http date
+func RetryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		d := time.Until(date)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}